@@ -20,14 +20,30 @@ func main() {
 	var format string
 	var maxDegree int
 	var outFile string
+	var partitionDir string
+	var memory string
 
 	flag.StringVar(&format, "format", "html", "html or pdf")
 	flag.IntVar(&maxDegree, "max-degree", 9, "max degree of symmetric group")
 	flag.StringVar(&outFile, "out", "abel-table.out", "output file")
+	flag.StringVar(&partitionDir, "partition-dir", "", "directory of partition files to map (see gen-partition-file)")
+	flag.StringVar(&memory, "mem", "", "memory budget per degree, e.g. 8G")
 	flag.Parse()
 
-	tab := den.NewAbelTable(maxDegree)
+	tab, err := den.NewAbelTable(maxDegree)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tab.PartitionDir = partitionDir
+	if memory != "" {
+		budget, err := den.ParseByteSize(memory)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tab.MemoryBudget = budget
+	}
 	tab.Generate()
+	defer tab.Close()
 
 	switch (format) {
 	case "html":
@@ -3,20 +3,33 @@
 package den
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"os"
 )
 
 type AbelTable struct {
 	MaxDegree int
-	Partitions []Partition
+	Partitions *PartitionStore
 	StringTable [][]string
+	// if set, partitions are mapped from the files named by
+	// PartitionFilePath in this directory, where present.
+	PartitionDir string
+	MemoryBudget int64 // per expander; see ExpanderV3.SetMemoryBudget
+	// if set, gets the phases and progress of the table and of its
+	// expanders in place of the log; see Observer.
+	Observer Observer
 }
 
-func NewAbelTable(maxDegree int) *AbelTable {
+// NewAbelTable returns the table of degrees 1 to maxDegree, which is at
+// most MaxPartitionStoreDegree.
+func NewAbelTable(maxDegree int) (*AbelTable, error) {
+	if err := checkDegree("abel table", maxDegree, MaxPartitionStoreDegree); err != nil {
+		return nil, err
+	}
 	return &AbelTable{
 		MaxDegree: maxDegree,
-	}
+	}, nil
 }
 
 // let N be the max n in the table.  we will generate all partitions
@@ -40,23 +53,83 @@ func NewAbelTable(maxDegree int) *AbelTable {
 //
 // finally, transpose the table for better printing fit.
 func (tab *AbelTable) Generate() {
-	tab.Partitions = AllPartitions(tab.MaxDegree)
+	if err := tab.GenerateContext(context.Background()); err != nil {
+		panic(err)
+	}
+}
+
+// GenerateContext is Generate, returning the error of ctx once it is
+// done, with the expander of the row in hand stopped.
+func (tab *AbelTable) GenerateContext(ctx context.Context) error {
+	o := observerOrDefault(tab.Observer)
+	t0 := beginPhase(o, PhaseGeneratingPartitions, tab.MaxDegree)
+	tab.Close()
+	if path := tab.partitionFile(tab.MaxDegree); path != "" {
+		store, err := OpenPartitionFile(path, tab.MaxDegree)
+		if err != nil {
+			return err
+		}
+		tab.Partitions = store
+	} else {
+		store, err := NewPartitionStore(tab.MaxDegree)
+		if err != nil {
+			return err
+		}
+		tab.Partitions = store
+	}
+	endPhase(o, PhaseGeneratingPartitions, tab.MaxDegree, tab.Partitions.Len(), t0)
+	t1 := beginPhase(o, PhaseGeneratingRows, tab.MaxDegree)
+	progress := progressReporter(o, PhaseGeneratingRows, tab.MaxDegree, tab.MaxDegree)
 	tab.StringTable = make([][]string, tab.MaxDegree)
 	for n := 1 ; n <= tab.MaxDegree; n++ {
-		tab.generateRow(n)
+		if err := tab.generateRow(ctx, o, n); err != nil {
+			return err
+		}
+		progress(NoWorker, 0, n)
 	}
-	log.Printf("xxx table before: %v", tab.StringTable)
 	tab.StringTable = transposeStringTable(tab.StringTable)
-	log.Printf("xxx table after: %v", tab.StringTable)
+	endPhase(o, PhaseGeneratingRows, tab.MaxDegree, tab.MaxDegree, t1)
+	return nil
 }
 
-func (tab *AbelTable) generateRow(n int) {
-	exp := NewExpanderV3(n)
-	exp.Expand()
-	partitions := AllPartitions(n)
-	tab.StringTable[n - 1] = make([]string, len(tab.Partitions)) // make all rows equal to the length of the longest row
+// Close releases the mapping of the partitions of the max degree, if
+// they were mapped from a file.
+func (tab *AbelTable) Close() error {
+	if tab.Partitions == nil {
+		return nil
+	}
+	return tab.Partitions.Close()
+}
+
+func (tab *AbelTable) partitionFile(n int) string {
+	if tab.PartitionDir == "" {
+		return ""
+	}
+	path := PartitionFilePath(tab.PartitionDir, n)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+func (tab *AbelTable) generateRow(ctx context.Context, o Observer, n int) error {
+	exp, err := NewExpanderV3(n)
+	if err != nil {
+		return err
+	}
+	defer exp.Close()
+	exp.SetObserver(o)
+	exp.SetPartitionFile(tab.partitionFile(n))
+	exp.SetMemoryBudget(tab.MemoryBudget)
+	if err := exp.ExpandContext(ctx); err != nil {
+		return err
+	}
+	partitions := exp.Partitions()
+	tab.StringTable[n - 1] = make([]string, tab.Partitions.Len()) // make all rows equal to the length of the longest row
 	var t CycleType = make([]int, n)
-	for i, p := range partitions {
+	buf := make([]int, n)
+	for i := 0; i < partitions.Len(); i++ {
+		p := partitions.PartitionAt(i, buf)
 		// xxx to start, just put the type and the width in
 		// the cell as a string, verify that partitions line
 		// up vertically as extensions by visual inspection.
@@ -68,6 +141,7 @@ func (tab *AbelTable) generateRow(n int) {
 // 		}
 		tab.StringTable[n - 1][i] = s
 	}
+	return nil
 }
 
 // assumes all rows are equal length
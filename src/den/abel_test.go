@@ -25,3 +25,33 @@ func TestTransposeStringTable(t *testing.T) {
 	}
 }
 
+
+func TestAbelTableFromPartitionFiles(t *testing.T) {
+	maxDegree := 7
+	dir := t.TempDir()
+	for n := 1; n <= maxDegree; n += 2 { // only some degrees have files
+		if err := WritePartitionFile(PartitionFilePath(dir, n), n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := NewAbelTable(maxDegree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected.Generate()
+	tab, err := NewAbelTable(maxDegree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab.PartitionDir = dir
+	tab.Generate()
+	if !tab.Partitions.Mapped() {
+		t.Errorf("expected mapped partitions for the max degree")
+	}
+	if err := tab.Close(); err != nil || tab.Partitions.Mapped() {
+		t.Errorf("expected the mapping released; err=%v", err)
+	}
+	if fmt.Sprint(tab.StringTable) != fmt.Sprint(expected.StringTable) {
+		t.Errorf("table from files differs;\nexpected=%v\ngot=%v", expected.StringTable, tab.StringTable)
+	}
+}
@@ -21,7 +21,10 @@ func main() {
 	var prevCpt, cpt *den.CPT
 	for i := begin; i <= end; i++ {
 		log.Printf("Generating n=%d", i)
-		cpt = den.New_CPT(i)
+		var err error
+		if cpt, err = den.New_CPT(i); err != nil {
+			log.Fatal(err)
+		}
 		if err := cpt.Generate(); err != nil {
 			panic(err)
 		}
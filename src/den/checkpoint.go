@@ -0,0 +1,309 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// checkpoints let a long ExpanderV3 run survive a reboot or an
+// interrupt.  a checkpoint holds the phase, the frontier of the phase
+// below which every partition is done, the partial width of a width
+// phase, and the whole mark table.  all integers are little endian.
+//
+//   offset  size  field
+//        0     8  magic "DENCHKPT"
+//        8     4  version
+//       12     4  degree n
+//       16     4  phase: 1 expanding, 2 summing the width
+//       20     4  reserved, zero
+//       24     8  size, p(n)
+//       32     8  frontier
+//       40     8  width bytes w
+//       48     8  crc64 (ecma) of the body
+//       56     4  crc32 (ieee) of bytes 0..55
+//       60     4  reserved, zero
+//       64        body: the partial width, w bytes big endian, then
+//                 the mark table, (size+63)/64 uint64 words
+//
+// the expansion may be resumed from any frontier with the marks of any
+// later moment: the marks only grow, and every type not yet marked
+// below the frontier gets expanded again after it, so the final mark
+// table, and with it the width, is the same as for an unbroken run.
+
+const CheckpointVersion = 1
+
+const checkpointMagic = "DENCHKPT"
+const checkpointHeaderSize = 64
+
+const (
+	checkpointExpanding = 1
+	checkpointSummingWidth = 2
+)
+
+// ErrInterrupted is returned by an ExpanderV3 that stops on its
+// interrupt channel, after writing its checkpoint.
+var ErrInterrupted = errors.New("expander interrupted")
+
+// DefaultCheckpointInterval is the interval used by the commands.
+const DefaultCheckpointInterval = 10 * time.Minute
+
+type checkpoint struct {
+	degree int
+	phase int
+	size int
+	frontier int
+	width *big.Int
+	marks []uint64
+}
+
+// CheckpointPath is the conventional name of the checkpoint of degree
+// n in dir.
+func CheckpointPath(dir string, n int) string {
+	return filepath.Join(dir, fmt.Sprintf("checkpoint-%d.den", n))
+}
+
+func (c *checkpoint) encodeHeader(bodySum uint64) []byte {
+	b := make([]byte, checkpointHeaderSize)
+	copy(b, checkpointMagic)
+	binary.LittleEndian.PutUint32(b[8:], CheckpointVersion)
+	binary.LittleEndian.PutUint32(b[12:], uint32(c.degree))
+	binary.LittleEndian.PutUint32(b[16:], uint32(c.phase))
+	binary.LittleEndian.PutUint64(b[24:], uint64(c.size))
+	binary.LittleEndian.PutUint64(b[32:], uint64(c.frontier))
+	binary.LittleEndian.PutUint64(b[40:], uint64(len(c.width.Bytes())))
+	binary.LittleEndian.PutUint64(b[48:], bodySum)
+	binary.LittleEndian.PutUint32(b[56:], crc32.ChecksumIEEE(b[:56]))
+	return b
+}
+
+// writeCheckpoint writes the phase and its progress with the current
+// marks to the checkpoint path, under a temporary name renamed into
+// place, so that the previous checkpoint survives a crash mid write.
+// the marks are read word by word as the workers set them.
+func (exp *ExpanderV3) writeCheckpoint(phase int, progress *chunkProgress) (err error) {
+	c := &checkpoint{degree: exp.degree, phase: phase, size: exp.markTable.size}
+	c.frontier, c.width = progress.state()
+	path := exp.checkpointPath
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+	if _, err = f.Seek(checkpointHeaderSize, io.SeekStart); err != nil {
+		return err
+	}
+	sum := crc64.New(crc64Table)
+	body := bufio.NewWriterSize(io.MultiWriter(f, sum), 1<<20)
+	body.Write(c.width.Bytes())
+	var word [8]byte
+	for i := range exp.markTable.bits {
+		binary.LittleEndian.PutUint64(word[:], atomic.LoadUint64(&exp.markTable.bits[i]))
+		body.Write(word[:])
+	}
+	if err = body.Flush(); err != nil {
+		return err
+	}
+	if _, err = f.WriteAt(c.encodeHeader(sum.Sum64()), 0); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+	exp.observer.Printf("wrote checkpoint; n=%d phase=%d frontier=%d/%d path=%s",
+		c.degree, c.phase, c.frontier, c.size, path)
+	return nil
+}
+
+// readCheckpoint reads the checkpoint at path, which must be of degree
+// with size partitions.
+func readCheckpoint(path string, degree, size int) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := decodeCheckpoint(data, degree, size)
+	if err != nil {
+		return nil, fmt.Errorf("%v; path=%s", err, path)
+	}
+	return c, nil
+}
+
+func decodeCheckpoint(b []byte, degree, size int) (*checkpoint, error) {
+	if len(b) < checkpointHeaderSize || string(b[:8]) != checkpointMagic {
+		return nil, fmt.Errorf("not a checkpoint")
+	}
+	if crc32.ChecksumIEEE(b[:56]) != binary.LittleEndian.Uint32(b[56:]) {
+		return nil, fmt.Errorf("checkpoint header checksum mismatch")
+	}
+	if v := binary.LittleEndian.Uint32(b[8:]); v != CheckpointVersion {
+		return nil, fmt.Errorf("unsupported checkpoint version; version=%d supported=%d", v, CheckpointVersion)
+	}
+	c := &checkpoint{
+		degree: int(binary.LittleEndian.Uint32(b[12:])),
+		phase: int(binary.LittleEndian.Uint32(b[16:])),
+	}
+	if c.degree != degree {
+		return nil, fmt.Errorf("checkpoint has wrong degree; expected=%d got=%d", degree, c.degree)
+	}
+	if c.phase != checkpointExpanding && c.phase != checkpointSummingWidth {
+		return nil, fmt.Errorf("checkpoint has unknown phase; phase=%d", c.phase)
+	}
+	sizeField := binary.LittleEndian.Uint64(b[24:])
+	frontier := binary.LittleEndian.Uint64(b[32:])
+	widthBytes := binary.LittleEndian.Uint64(b[40:])
+	if sizeField != uint64(size) {
+		return nil, fmt.Errorf("checkpoint has wrong number of partitions; expected=%d got=%d", size, sizeField)
+	}
+	if frontier > sizeField {
+		return nil, fmt.Errorf("checkpoint frontier out of range; frontier=%d size=%d", frontier, sizeField)
+	}
+	words := (size + 63) / 64
+	body := b[checkpointHeaderSize:]
+	if widthBytes > uint64(len(body)) || uint64(len(body)) != widthBytes+8*uint64(words) {
+		return nil, fmt.Errorf("checkpoint size mismatch; expected=%d got=%d",
+			checkpointHeaderSize+widthBytes+8*uint64(words), len(b))
+	}
+	if crc64.Checksum(body, crc64Table) != binary.LittleEndian.Uint64(b[48:]) {
+		return nil, fmt.Errorf("checkpoint body checksum mismatch")
+	}
+	c.size = size
+	c.frontier = int(frontier)
+	c.width = new(big.Int).SetBytes(body[:widthBytes])
+	c.marks = make([]uint64, words)
+	for i := range c.marks {
+		c.marks[i] = binary.LittleEndian.Uint64(body[widthBytes+8*uint64(i):])
+	}
+	return c, nil
+}
+
+// startCheckpoints writes a checkpoint of the phase every interval
+// until the returned function is called.
+func (exp *ExpanderV3) startCheckpoints(phase int, progress *chunkProgress) (stop func()) {
+	if exp.checkpointPath == "" || exp.checkpointInterval <= 0 {
+		return func() {}
+	}
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(exp.checkpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				if err := exp.writeCheckpoint(phase, progress); err != nil {
+					exp.observer.Printf("checkpoint failed; n=%d err=%v", exp.degree, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-done
+	}
+}
+
+// InterruptOnSignal returns a channel for SetInterrupt that is closed
+// on the first SIGINT, on which the expander checkpoints and stops.  a
+// second SIGINT kills the process as usual.
+func InterruptOnSignal() <-chan struct{} {
+	ch := make(chan struct{})
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		<-sigs
+		signal.Stop(sigs)
+		log.Printf("interrupted; checkpointing after the chunks in hand")
+		close(ch)
+	}()
+	return ch
+}
+
+// stopIfInterrupted checkpoints the phase and returns ErrInterrupted
+// if the interrupt channel is closed.
+func (exp *ExpanderV3) stopIfInterrupted(phase int, progress *chunkProgress) error {
+	if !interrupted(exp.interrupt) {
+		return nil
+	}
+	if exp.checkpointPath != "" {
+		if err := exp.writeCheckpoint(phase, progress); err != nil {
+			return err
+		}
+	}
+	return ErrInterrupted
+}
+
+func interrupted(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// resume loads the checkpoint named by ResumeFrom, once the partitions
+// and the mark table are in place.
+func (exp *ExpanderV3) resume() error {
+	if exp.resumePath == "" {
+		return nil
+	}
+	c, err := readCheckpoint(exp.resumePath, exp.degree, exp.partitions.Len())
+	if err != nil {
+		return err
+	}
+	exp.resumePath = ""
+	copy(exp.markTable.bits, c.marks)
+	switch c.phase {
+	case checkpointExpanding:
+		exp.firstNew = c.frontier
+		if end := exp.expansionEnd(); c.frontier > end {
+			return fmt.Errorf("checkpoint frontier past the shard; frontier=%d end=%d", c.frontier, end)
+		}
+	case checkpointSummingWidth:
+		exp.expanded = true
+		exp.resumed = c
+	}
+	exp.observer.Printf("resumed from checkpoint; n=%d phase=%d frontier=%d/%d", exp.degree, c.phase, c.frontier, c.size)
+	return nil
+}
+
+// RemoveCheckpoint removes the checkpoint file, if any; the expander
+// removes it itself once the width is known.
+func (exp *ExpanderV3) RemoveCheckpoint() error {
+	if exp.checkpointPath == "" {
+		return nil
+	}
+	if err := os.Remove(exp.checkpointPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// interruptAfter runs Width on exp with an interrupt that closes once
+// the given number of chunks have completed, and reports whether it
+// was interrupted.
+func interruptAfter(exp *ExpanderV3, chunks int32) bool {
+	ch := make(chan struct{})
+	var once sync.Once
+	var count int32
+	exp.SetInterrupt(ch)
+	exp.onChunk = func() {
+		if atomic.AddInt32(&count, 1) >= chunks {
+			once.Do(func() { close(ch) })
+		}
+	}
+	_, err := exp.WidthContext(context.Background())
+	if err != nil && err != ErrInterrupted {
+		panic(err)
+	}
+	return err == ErrInterrupted
+}
+
+func TestExpanderV3ResumeIsIdentical(t *testing.T) {
+	d := 30
+	if testing.Short() {
+		d = 24
+	}
+	workers := 3
+	reference, err := NewExpanderV3(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reference.SetNumWorkers(workers)
+	reference.Width()
+	size := reference.partitions.Len()
+	expansionChunks := (size + workChunkSize(size, workers) - 1) / workChunkSize(size, workers)
+	type tcase struct {
+		name string
+		chunks int32
+		phase int
+	}
+	tcases := []tcase{
+		tcase{"early", 1, checkpointExpanding},
+		tcase{"expanding", int32(expansionChunks / 2), checkpointExpanding},
+		tcase{"summing", int32(expansionChunks + 5), checkpointSummingWidth},
+	}
+	for _, c := range tcases {
+		path := CheckpointPath(t.TempDir(), d)
+		exp, err := NewExpanderV3(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp.SetNumWorkers(workers)
+		exp.SetCheckpoint(path, 0)
+		if !interruptAfter(exp, c.chunks) {
+			t.Fatalf("%s; expected interrupt", c.name)
+		}
+		saved, err := readCheckpoint(path, d, size)
+		if err != nil {
+			t.Fatalf("%s; %v", c.name, err)
+		}
+		if saved.phase != c.phase || saved.frontier == size {
+			t.Errorf("%s; expected phase=%d got phase=%d frontier=%d/%d", c.name, c.phase, saved.phase, saved.frontier, size)
+		}
+		resumed, err := NewExpanderV3(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resumed.SetNumWorkers(2)
+		resumed.SetCheckpoint(path, 0)
+		resumed.ResumeFrom(path)
+		if resumed.Width().Cmp(reference.Width()) != 0 {
+			t.Errorf("%s; width expected=%v got=%v", c.name, reference.Width(), resumed.Width())
+		}
+		for i := range reference.bits {
+			if resumed.bits[i] != reference.bits[i] {
+				t.Errorf("%s; marks differ at word %d", c.name, i)
+				break
+			}
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s; expected checkpoint removed after width; err=%v", c.name, err)
+		}
+	}
+}
+
+func TestCheckpointRejectsBadFiles(t *testing.T) {
+	d := 12
+	path := CheckpointPath(t.TempDir(), d)
+	exp, err := NewExpanderV3(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.SetCheckpoint(path, 0)
+	if err := exp.Expand(); err != nil { // leaves a checkpoint of the width phase
+		t.Fatal(err)
+	}
+	good, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := exp.partitions.Len()
+	type tcase struct {
+		name string
+		degree int
+		corrupt func(b []byte) []byte
+		expected string
+	}
+	tcases := []tcase{
+		tcase{"good", d, func(b []byte) []byte { return b }, ""},
+		tcase{"magic", d, func(b []byte) []byte { b[0] = 'X'; return b }, "not a checkpoint"},
+		tcase{"header", d, func(b []byte) []byte { b[32]++; return b }, "header checksum"},
+		tcase{"degree", d + 1, func(b []byte) []byte { return b }, "wrong degree"},
+		tcase{"body", d, func(b []byte) []byte { b[len(b)-1] ^= 1; return b }, "body checksum"},
+		tcase{"truncated", d, func(b []byte) []byte { return b[:len(b)-8] }, "size mismatch"},
+	}
+	for _, c := range tcases {
+		b := c.corrupt(append([]byte(nil), good...))
+		_, err := decodeCheckpoint(b, c.degree, size)
+		if c.expected == "" {
+			if err != nil {
+				t.Errorf("%s; unexpected error %v", c.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("%s; expected error containing %q got=%v", c.name, c.expected, err)
+		}
+	}
+}
+
+func TestInterruptOnSignal(t *testing.T) {
+	ch := InterruptOnSignal()
+	if interrupted(ch) {
+		t.Fatalf("interrupted before any signal")
+	}
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Skipf("cannot send SIGINT here: %v", err)
+	}
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Errorf("expected the channel closed on SIGINT")
+	}
+}
@@ -3,142 +3,315 @@
 package den
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"image/color"
+	"io"
 	//"log"
 	"math/big"
-	"strings"
+	"sort"
 	"time"
 )
 
-// conjugate power table (CPT)
+// conjugate power table (CPT).  row i lists the types of the powers
+// lambda_i^1, ..., lambda_i^m, where m is the order of lambda_i; the
+// rows are held compressed, see cptRow.
 type CPT struct {
 	degree int
 	cycleTypes []CycleType // index table; associates i to lambda_i
-	cycleTypeMap map[string]int // string form of cycle type -> index
-	result [][]int // indices
-	markup [][]bool // structure mirrors result
+	cycleTypeMap map[Type]int // index of each type
+	rows []cptRow
+	nonMaximal []bool // the markup: lambda_i is a proper power of another type
 	width *big.Int
+	observer Observer
 
 	GenTime time.Duration       // xxx old
 	PartitionTime time.Duration 
 	WidthTime time.Duration
 }
 
-func New_CPT(degree int) *CPT {
+// New_CPT returns the empty table of degree, which is at most
+// MaxTypeDegree; Generate fills it.
+func New_CPT(degree int) (*CPT, error) {
+	if err := checkDegree("CPT", degree, MaxTypeDegree); err != nil {
+		return nil, err
+	}
 	cpt := new(CPT)
 	cpt.degree = degree
 	cpt.cycleTypes = make([]CycleType, 0)
-	cpt.cycleTypeMap = make(map[string]int)
-	cpt.result = make([][]int, 0)
-	return cpt
+	cpt.cycleTypeMap = make(map[Type]int)
+	cpt.observer = defaultObserver
+	return cpt, nil
+}
+
+// SetObserver makes Generate report to o rather than log; nil restores
+// logging.
+func (cpt *CPT) SetObserver(o Observer) {
+	cpt.observer = observerOrDefault(o)
+}
+
+// cptRow is the row of a type t of order m.  the type of t^k depends
+// only on gcd(k, m), so rather than one entry per exponent the row
+// holds one image per divisor d of m, in increasing order of d: the
+// type of t^d, and the number phi(m/d) of exponents k in 1..m with
+// gcd(k, m) = d.  images[0] is t itself and the last is the identity.
+type cptRow struct {
+	order int
+	images []cptImage
+}
+
+type cptImage struct {
+	divisor int
+	index int // of the type of t^divisor
+	multiplicity int
+}
+
+// entry returns the j-th entry of the full row, the index of the type
+// of t^(j+1).
+func (row *cptRow) entry(j int) int {
+	d := GCD(j+1, row.order)
+	k := sort.Search(len(row.images), func(k int) bool {
+		return row.images[k].divisor >= d
+	})
+	return row.images[k].index
+}
+
+// marked reports the markup of the j-th entry of row i: the entry is
+// struck out if lambda_i is not maximal, or if the power is a
+// different type.
+func (cpt *CPT) marked(i, j int) bool {
+	return cpt.nonMaximal[i] || cpt.rows[i].entry(j) != i
 }
 
 func (cpt *CPT) Degree() int {
 	return cpt.degree
 }
 
-func (cpt *CPT) String() (s string) {
-	s = "types:\n"
-	for i, lambda := range cpt.cycleTypes {
-		s += fmt.Sprintf("%v: %v\n", i+1, lambda.StringForPartitionWithoutOneCycles()) // +1 for sanity
+func (cpt *CPT) String() string {
+	return renderString(cpt.WriteTo)
+}
+
+// WriteTo writes the String form: the types, then the table with its
+// markup.
+func (cpt *CPT) WriteTo(w io.Writer) (int64, error) {
+	r := newRenderer(w)
+	r.print("types:\n")
+	for i := range cpt.cycleTypes {
+		r.int(i + 1) // +1 for sanity
+		r.print(": ")
+		r.print(cpt.cycleTypes[i].StringForPartitionWithoutOneCycles())
+		r.print("\n")
 	}
-	s += "table:\n"
-	for i, row := range cpt.result {
-		for j, x := range row {
+	r.print("table:\n")
+	for i := range cpt.rows {
+		row := &cpt.rows[i]
+		for j := 0; j < row.order; j++ {
 			if j > 0 {
-				s += " "
+				r.print(" ")
 			}
-			if cpt.markup != nil && cpt.markup[i][j] {
-				s+= "/"
+			if cpt.nonMaximal != nil && cpt.marked(i, j) {
+				r.print("/")
 			}
-			s += fmt.Sprint(x + 1) // +1 for sanity
+			r.int(row.entry(j) + 1) // +1 for sanity
 		}
-		s += "\n"
+		r.print("\n")
 	}
-	return s
+	return r.done()
+}
+
+func (cpt *CPT) TableString() string {
+	return renderString(cpt.WriteTable)
 }
 
-func (cpt *CPT) TableString() (s string) {
-	for _, row := range cpt.result {
-		s += "1" // for symmetry when text is centered
-		for _, x := range row {
-			s += " "
-			s += fmt.Sprint(x + 1) // +1 for sanity
+func (cpt *CPT) WriteTable(w io.Writer) (int64, error) {
+	r := newRenderer(w)
+	cpt.renderTable(r, "\n")
+	return r.done()
+}
+
+func (cpt *CPT) renderTable(r *renderer, eol string) {
+	for i := range cpt.rows {
+		row := &cpt.rows[i]
+		r.print("1") // for symmetry when text is centered
+		for j := 0; j < row.order; j++ {
+			r.print(" ")
+			r.int(row.entry(j) + 1) // +1 for sanity
 		}
-		s += "\n"
+		r.print(eol)
 	}
-	return s
 }
 
-// xxx todo1: do not generate full PFTs, but rather use the
-// CycleType.Power method.  xxx todo2: consider instead of building
-// this CPT table, building the cycle power graph.
+// each row is built from CycleType.PowerFactorization, one power per
+// divisor of the order, rather than from a full PFT.  xxx todo:
+// consider instead of building this CPT table, building the cycle
+// power graph.
 func (cpt *CPT) Generate() error {
-	t0 := time.Now()
+	return cpt.GenerateContext(context.Background())
+}
+
+// cptCheckRows is how many rows GenerateContext builds between looks
+// at its context.
+const cptCheckRows = 256
+
+// GenerateContext is Generate, returning the error of ctx once it is
+// done.  the table is then incomplete.
+func (cpt *CPT) GenerateContext(ctx context.Context) error {
+	o := cpt.observer
+	t0 := beginPhase(o, PhaseGeneratingPartitions, cpt.degree)
 	//fmt.Printf("generating K_{S_%d}\n", cpt.degree)
-	var yield chan Partition = YieldAllPartitions(cpt.degree)
 	i := 0
-	for x := range yield {
-		lambda := x.CycleTypeOld()
+	for it := NewPartitionIterator(cpt.degree, nil); it.Next(); {
+		lambda := it.Partition().CycleTypeOld()
 		cpt.cycleTypes = append(cpt.cycleTypes, lambda)
-		cpt.cycleTypeMap[lambda.HashKeyString()] = i
+		cpt.cycleTypeMap[it.Partition().Type()] = i
 		i++
 	}
-	cpt.PartitionTime = time.Since(t0)
-	t1 := time.Now()
-	for _, lambda := range cpt.cycleTypes {
-		var P *PFT = NewPFT(cpt.degree, lambda)
-		P.Generate()
-		//fmt.Printf("  P=\n%v\n", P)
-		P.Check()
-		// resolve to row of indices in result table
-		row := make([]int, 0)
-		for _, y := range P.data {
-			row = append(row, cpt.cycleTypeMap[y.HashKeyString()])
+	cpt.PartitionTime = endPhase(o, PhaseGeneratingPartitions, cpt.degree, len(cpt.cycleTypes), t0)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	t1 := beginPhase(o, PhaseGeneratingRows, cpt.degree)
+	progress := progressReporter(o, PhaseGeneratingRows, cpt.degree, len(cpt.cycleTypes))
+	cpt.rows = make([]cptRow, len(cpt.cycleTypes))
+	var u CycleType = make([]int, cpt.degree)
+	for i, lambda := range cpt.cycleTypes {
+		if i%cptCheckRows == 0 && i > 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			progress(NoWorker, 0, i)
 		}
-		cpt.result = append(cpt.result, row)
+		order := lambda.OrderFactorization()
+		m, ok := order.Int64()
+		if !ok {
+			return fmt.Errorf("order of type overflows; type=%v order=%v", &lambda, order)
+		}
+		row := cptRow{order: int(m)}
+		for _, d := range order.Divisors() {
+			lambda.PowerFactorization(d, u)
+			index, found := cpt.cycleTypeMap[u.Type()]
+			if !found {
+				return fmt.Errorf("power of type not found; type=%v power=%v image=%v", &lambda, d, &u)
+			}
+			divisor, _ := d.Int64()
+			cofactor := order.merge(d, func(a, b int) int { return a - b })
+			row.images = append(row.images, cptImage{
+				divisor: int(divisor),
+				index: index,
+				multiplicity: int(cofactor.Totient().Int64()),
+			})
+		}
+		sort.Slice(row.images, func(a, b int) bool {
+			return row.images[a].divisor < row.images[b].divisor
+		})
+		cpt.rows[i] = row
 	}
-	cpt.GenTime = time.Since(t1)
+	progress(NoWorker, 0, len(cpt.rows))
+	cpt.GenTime = endPhase(o, PhaseGeneratingRows, cpt.degree, len(cpt.rows), t1)
 	return nil
 }
 
+// Check verifies the generated table: each type is a partition of the
+// degree, at its index in cycleTypeMap; each row begins with the type
+// itself, and has one image per divisor of the order of the type, the
+// LCM of its cycle lengths, ending with the identity; the image of d
+// has order m/d, and stands for phi(m/d) exponents, m in all, so the
+// full row has period m.
 func (cpt *CPT) Check() error {
-	// xxx todo
+	fail := func(row, column int, format string, args ...interface{}) error {
+		return &CheckError{"CPT", cpt.degree, row, column, fmt.Sprintf(format, args...)}
+	}
+	if cpt.rows == nil {
+		return fail(-1, -1, "not generated")
+	}
+	if len(cpt.rows) != len(cpt.cycleTypes) || len(cpt.cycleTypeMap) != len(cpt.cycleTypes) {
+		return fail(-1, -1, "rows=%d types=%d indexed=%d", len(cpt.rows), len(cpt.cycleTypes),
+			len(cpt.cycleTypeMap))
+	}
+	orders := make([]int, len(cpt.cycleTypes))
+	for i, t := range cpt.cycleTypes {
+		if err := checkCycleType(t, cpt.degree); err != nil {
+			return fail(i, -1, "%v", err)
+		}
+		if index, found := cpt.cycleTypeMap[t.Type()]; !found || index != i {
+			return fail(i, -1, "type %v is indexed at %d", &t, index)
+		}
+		m, ok := t.OrderFactorization().Int64()
+		if !ok {
+			return fail(i, -1, "order of type %v overflows", &t)
+		}
+		orders[i] = int(m)
+	}
+	var identity CycleType = make([]int, cpt.degree)
+	identity[0] = cpt.degree
+	for i := range cpt.rows {
+		row := &cpt.rows[i]
+		if row.order != orders[i] {
+			return fail(i, -1, "order=%d, but the cycle lengths have lcm %d", row.order, orders[i])
+		}
+		if len(row.images) == 0 || row.images[0].divisor != 1 || row.images[0].index != i {
+			return fail(i, 0, "row does not begin with the type itself")
+		}
+		if n := Factor(row.order).NumDivisors(); len(row.images) != n {
+			return fail(i, -1, "images=%d, but the order %d has %d divisors", len(row.images), row.order, n)
+		}
+		exponents := 0
+		for j, image := range row.images {
+			if j > 0 && image.divisor <= row.images[j-1].divisor {
+				return fail(i, j, "divisors out of order")
+			}
+			if image.divisor < 1 || row.order%image.divisor != 0 {
+				return fail(i, j, "%d does not divide the order %d", image.divisor, row.order)
+			}
+			if image.index < 0 || image.index >= len(cpt.cycleTypes) {
+				return fail(i, j, "image index %d out of range", image.index)
+			}
+			if orders[image.index] != row.order/image.divisor {
+				return fail(i, j, "image of order %d, expected %d", orders[image.index], row.order/image.divisor)
+			}
+			phi := Factor(row.order / image.divisor).Totient().Int64()
+			if int64(image.multiplicity) != phi {
+				return fail(i, j, "multiplicity=%d, expected %d", image.multiplicity, phi)
+			}
+			exponents += image.multiplicity
+		}
+		if exponents != row.order {
+			return fail(i, -1, "images stand for %d exponents, expected %d", exponents, row.order)
+		}
+		if last := row.images[len(row.images)-1].index; last != cpt.cycleTypeMap[identity.Type()] {
+			return fail(i, len(row.images)-1, "last image %v is not the identity", &cpt.cycleTypes[last])
+		}
+	}
 	return nil
 }
 
+// every power t^d with d > 1 dividing the order of t has a smaller
+// order than t, so is a different type, and is not maximal.
 func (cpt *CPT) genMarkup() {
-	if cpt.markup != nil {
+	if cpt.nonMaximal != nil {
 		return
 	}
-	markup := make([][]bool, len(cpt.result))
-	for i := 0; i < len(cpt.result); i++ {
-		markup[i] = make([]bool, len(cpt.result[i]))
-	}
-	for i, row := range cpt.result {
-		p := row[0]
-		for j, x := range row {
-			if j > 0 && x != p {
-				markup[i][j] = true
-				for z := 0; z < len(markup[x]); z++ {
-					markup[x][z] = true
-				}
-			}
+	nonMaximal := make([]bool, len(cpt.rows))
+	for _, row := range cpt.rows {
+		for _, image := range row.images[1:] {
+			nonMaximal[image.index] = true
 		}
 	}
-	cpt.markup = markup
+	cpt.nonMaximal = nonMaximal
 // 	fmt.Printf("xxx K with markup = \n%v", cpt)
 }
 
-func (cpt *CPT) calculateWidth() {
+func (cpt *CPT) calculateWidth() error {
 	t0 := time.Now()
-	if cpt.markup == nil {
+	if cpt.rows == nil {
+		return fmt.Errorf("cpt not generated; n=%d", cpt.degree)
+	}
+	if cpt.nonMaximal == nil {
 		cpt.genMarkup()
 	}
 	width := big.NewInt(0)
-	for i := range cpt.result {
+	for i := range cpt.rows {
 		// xxx this is effectively calculating the number of
 		// totatives of the LCM of the lengths of the cycle type cycles
 		var x int = cpt.elementsPerTypeGroup(i)
@@ -146,13 +319,16 @@ func (cpt *CPT) calculateWidth() {
 			//fmt.Printf("xxx i=%v x=%v\n", i+1, x) // +1 for sanity
 			continue
 		}
-		var z *big.Int = cpt.elementsWithType(i)
+		z, err := cpt.elementsWithType(i)
+		if err != nil {
+			return err
+		}
 		// sanity check
 		bx := big.NewInt(int64(x))
 		bz := big.NewInt(0)
 		bz.Set(z)
 		if bz.Mod(bz, bx).Sign() != 0 {
-			panic(fmt.Sprintf("z=%v is not a multiple of x=%v", z, x))
+			return fmt.Errorf("z=%v is not a multiple of x=%v", z, x)
 		}
 		y := big.NewInt(0)
 		y.Set(z)
@@ -162,27 +338,22 @@ func (cpt *CPT) calculateWidth() {
 	}
 	cpt.width = width
 	cpt.WidthTime = time.Since(t0)
+	return nil
 }
 
+// the unmarked entries of a maximal row are the exponents coprime to
+// the order, which all give the type itself.
 func (cpt *CPT) elementsPerTypeGroup(x int) int {
-	if cpt.markup == nil {
+	if cpt.nonMaximal == nil {
 		return -1
 	}
-	row := cpt.result[x]
-	var z int
-	for j := range row {
-		if cpt.markup[x][j] {
-			if j == 0 {
-				break
-			}
-		} else {
-			z++
-		}
+	if cpt.nonMaximal[x] {
+		return 0
 	}
-	return z
+	return cpt.rows[x].images[0].multiplicity
 }
 
-func (cpt *CPT) elementsWithType(x int) *big.Int {
+func (cpt *CPT) elementsWithType(x int) (*big.Int, error) {
 	var k *big.Int = Factorial(cpt.degree)
 	var lambda CycleType = cpt.cycleTypes[x]
 	// xxx refactor to use cardinalityOfCentralizerOfType
@@ -197,12 +368,12 @@ func (cpt *CPT) elementsWithType(x int) *big.Int {
 		b := big.NewInt(0)
 		b.Set(k)
 		if b.Mod(b, z).Sign() != 0 {
-			panic(fmt.Sprintf("k=%v is not a multiple of z=%v", k, z))
+			return nil, fmt.Errorf("k=%v is not a multiple of z=%v", k, z)
 		}
 
 		k.Div(k, z)
 	}
-	return k
+	return k, nil
 }
 
 func (cpt *CPT) CardinalityOfCentralizerOfType(t CycleType) *big.Int {
@@ -216,9 +387,12 @@ func (cpt *CPT) CardinalityOfCentralizerOfType(t CycleType) *big.Int {
 	return k
 }
 
+// Width panics if the table is not generated, or fails a sanity check.
 func (cpt *CPT) Width() *big.Int {
 	if cpt.width == nil {
-		cpt.calculateWidth()
+		if err := cpt.calculateWidth(); err != nil {
+			panic(err)
+		}
 	}
 	return cpt.width
 }
@@ -237,11 +411,12 @@ func (cpt *CPT) NumCycleTypes() int {
 	return len(cpt.cycleTypes)
 }
 
+// Diameter is the largest order of the types, whose orders Generate
+// has checked fit an int; 0 before Generate.
 func (cpt *CPT) Diameter() int {
 	var max int
-	for _, lambda := range cpt.cycleTypes {
-		d := lambda.Order()
-		if d > max {
+	for i := range cpt.rows {
+		if d := cpt.rows[i].order; d > max {
 			max = d
 		}
 	}
@@ -249,36 +424,40 @@ func (cpt *CPT) Diameter() int {
 }
 
 func (cpt *CPT) MaximalTypesMatrixString() string {
-	var s string
+	return renderString(cpt.WriteMaximalTypesMatrix)
+}
+
+func (cpt *CPT) WriteMaximalTypesMatrix(w io.Writer) (int64, error) {
+	r := newRenderer(w)
 	for i := 0; i < cpt.degree; i++ {
 		if i > 0 {
-			s += " "
+			r.print(" ")
 		}
-		s += fmt.Sprintf("%4d", i+1)
+		r.printf("%4d", i+1)
 	}
-	s += "\n"
+	r.print("\n")
 	for i := 0; i < cpt.degree; i++ {
 		if i > 0 {
-			s += "-"
+			r.print("-")
 		}
-		s += fmt.Sprint("----")
+		r.print("----")
 	}
-	s += "\n"
+	r.print("\n")
 	types := cpt.MaximalTypes()
 	for _, z := range types {
 		for j, t := range *z {
 			if j > 0 {
-				s += " "
+				r.print(" ")
 			}
 			if t > 0 {
-				s += fmt.Sprintf("%4d", t)
+				r.printf("%4d", t)
 			} else {
-				s += "    "
+				r.print("    ")
 			}
 		}
-		s += "  [" + z.StringForPartitionWithoutOneCycles() + "]\n"
+		r.print("  [" + z.StringForPartitionWithoutOneCycles() + "]\n")
 	}
-	return s
+	return r.done()
 }
 
 func (cpt *CPT) NumMaximalTypes() int {
@@ -289,7 +468,7 @@ func (cpt *CPT) MaximalTypes() []*CycleType {
 	cpt.Width()
 	result := make([]*CycleType, 0)
 	for i, z := range cpt.cycleTypes {
-		if cpt.markup[i][0] { // not maximal
+		if cpt.nonMaximal[i] {
 			continue
 		}
 		result = append(result, &z)
@@ -325,20 +504,19 @@ type Logarithm struct {
 // types to the zeroth power.
 func (cpt *CPT) Logarithms(u *CycleType) []Logarithm {
 	logarithms := make([]Logarithm, 0)
-	key := u.HashKeyString() // todo: improve this
-	uIndex := cpt.cycleTypeMap[key]
-	//log.Printf("xxx Logarithm key=%v uIndex=%v", key, uIndex)
-	for _, row := range cpt.result {
-		baseTypeIndex := 0
-		//log.Printf("xxx Logarithm check row=%v", row)
-		for j, x := range row {
-			//log.Printf("xxx Logarithm check j=%v x=%v", j, x)
-			if j == 0 {
-				baseTypeIndex = x
+	uIndex := cpt.cycleTypeMap[u.Type()]
+	//log.Printf("xxx Logarithm u=%v uIndex=%v", u, uIndex)
+	for i := range cpt.rows {
+		row := &cpt.rows[i]
+		for _, image := range row.images {
+			if image.index != uIndex {
+				continue
 			}
-			if x == uIndex {
-				//log.Printf("xxx match uIndex=%v", uIndex)
-				logarithms = append(logarithms, Logarithm{&cpt.cycleTypes[baseTypeIndex], j+1})
+			// the exponents k with gcd(k, order) = divisor
+			for k := image.divisor; k <= row.order; k += image.divisor {
+				if GCD(k, row.order) == image.divisor {
+					logarithms = append(logarithms, Logarithm{&cpt.cycleTypes[i], k})
+				}
 			}
 		}
 	}
@@ -346,29 +524,35 @@ func (cpt *CPT) Logarithms(u *CycleType) []Logarithm {
 	return logarithms
 }
 
-func (cpt *CPT) Latex() (s string) {
-	var colstring string
-	var d = cpt.Diameter()
-	for i := 0; i < d; i++ {
-		colstring += "r "
+func (cpt *CPT) Latex() string {
+	return renderString(cpt.WriteLatex)
+}
+
+func (cpt *CPT) WriteLatex(w io.Writer) (int64, error) {
+	r := newRenderer(w)
+	r.print("\\begin{tabular}{")
+	for i, d := 0, cpt.Diameter(); i < d; i++ {
+		r.print("r ")
 	}
-	s = fmt.Sprintf("\\begin{tabular}{%v}\n", colstring)
-	for i, row := range cpt.result {
-		for j, x := range row {
+	r.print("}\n")
+	for i := range cpt.rows {
+		row := &cpt.rows[i]
+		for j := 0; j < row.order; j++ {
 			if j > 0 {
-				s += " & "
+				r.print(" & ")
 			}
-			z := fmt.Sprint(x + 1) // +1 for sanity
-			if cpt.markup != nil && cpt.markup[i][j] {
-				s += fmt.Sprintf("\\cancel{%v}", z)
+			if cpt.nonMaximal != nil && cpt.marked(i, j) {
+				r.print("\\cancel{")
+				r.int(row.entry(j) + 1) // +1 for sanity
+				r.print("}")
 			} else {
-				s += z
+				r.int(row.entry(j) + 1)
 			}
 		}
-		s += " \\\\\n"
-	}	
-	s += "\\end{tabular}\n"
-	return s
+		r.print(" \\\\\n")
+	}
+	r.print("\\end{tabular}\n")
+	return r.done()
 }
 
 func (cpt *CPT) Image() (img image.Image) {
@@ -386,35 +570,41 @@ func (cpt *CPT) ImageWithCellDimensions(cellwidth, cellheight, paddingx, padding
 
 // graphviz 
 func (cpt *CPT) Dot() string {
-	out := "digraph G\n"
-	out += "{\n"
-	table := strings.Replace(cpt.TableString(), "\n", "\\n", -1)
- 	out += fmt.Sprintf("  graph [label=\"T_%d\n%v\" labelfontsize=0.5 labeldistance=10];\n", cpt.degree, table)
-//	out += "node [shape=point width=0.015];\n"
-//	out += "node [penwidth=0.25];\n"
-	out += "node [shape=none];\n"
- 	out += "edge [penwidth=0.25 arrowsize=0.5 color=\"#ff000077\"];\n"
+	return renderString(cpt.WriteDot)
+}
+
+func (cpt *CPT) WriteDot(w io.Writer) (int64, error) {
+	r := newRenderer(w)
+	r.print("digraph G\n")
+	r.print("{\n")
+	r.printf("  graph [label=\"T_%d\n", cpt.degree)
+	cpt.renderTable(r, "\\n")
+	r.print("\" labelfontsize=0.5 labeldistance=10];\n")
+//	r.print("node [shape=point width=0.015];\n")
+//	r.print("node [penwidth=0.25];\n")
+	r.print("node [shape=none];\n")
+ 	r.print("edge [penwidth=0.25 arrowsize=0.5 color=\"#ff000077\"];\n")
 	// vertices
-	for i, t := range cpt.cycleTypes {
-		out += fmt.Sprintf("\"%v\"\n", cpt.CycleTypeDescription(i, &t))
+	for i := range cpt.cycleTypes {
+		r.print("\"" + cpt.CycleTypeDescriptionFromIndex(i) + "\"\n")
 	}
 	// xxx this is broken.  what is wanted is a hasse diagram.  in
 	// order to make a hasse diagram, start with the full power
 	// graph, then remove edges that bypass a "cover".  for now,
 	// just draw the whole power graph.
-	for _, row := range cpt.result {
-		b := row[0]
-		for j := 1; j < len(row); j++ {
-			if row[j] == b {
+	for b := range cpt.rows {
+		row := &cpt.rows[b]
+		for j := 1; j < row.order; j++ {
+			x := row.entry(j)
+			if x == b {
 				continue
 			}
-			out += fmt.Sprintf("\"%v\" -> \"%v\"\n",
-				cpt.CycleTypeDescriptionFromIndex(b),
-				cpt.CycleTypeDescriptionFromIndex(row[j]))
+			r.print("\"" + cpt.CycleTypeDescriptionFromIndex(b) + "\" -> \"" +
+				cpt.CycleTypeDescriptionFromIndex(x) + "\"\n")
 		}
 	}
-	out += "}\n";
-	return out
+	r.print("}\n")
+	return r.done()
 }
 
 func (cpt *CPT) CycleTypeDescriptionFromIndex(index int) string {
@@ -443,13 +633,13 @@ func (gen *cptImageGenerator) generate(cpt *CPT) *image.RGBA {
 	cpt.genMarkup()
 	diameter := cpt.Diameter()
 	totalwidth := gen.CellWidth * diameter + (diameter - 1) * gen.PaddingX
-	rows := len(cpt.result)
+	rows := len(cpt.rows)
 	totalheight := gen.CellHeight * rows + (rows - 1) * gen.PaddingY
 	gen.img = image.NewRGBA(image.Rect(0, 0, totalwidth, totalheight))
-	for i, row := range cpt.result {
+	for i, row := range cpt.rows {
 		for j := 0; j < diameter; j++ {
-			if j < len(row) {
-				if cpt.markup[i][j] {
+			if j < row.order {
+				if cpt.marked(i, j) {
 					gen.drawMarkedCell(i, j)
 				} else {
 					gen.drawUnmarkedCell(i, j)
@@ -24,7 +24,10 @@ func TestLogarithms(t *testing.T) {
 		u := RandomCycleType(degree)
 		k := rand.Intn(maxPower)
 		v := u.PowerOld(k)
-		o := u.Order()
+		o, err := u.Order()
+		if err != nil {
+			t.Fatal(err)
+		}
 		r := k % o
 		if r == 0 {
 			// We don't include the zeroth powers in
@@ -39,7 +42,10 @@ func TestLogarithms(t *testing.T) {
 // 		reducedPower := k % u.Order()
 // 		log.Printf("xxx i=%d d=%d u=%v k=%v r=%d v=%v", i, degree, u, k, reducedPower, v)
 // 		//log.Printf("xxx pft:\n%v", P)
-		C := New_CPT(degree)
+		C, err := New_CPT(degree)
+		if err != nil {
+			t.Fatal(err)
+		}
 		C.Generate()
 		logarithms := C.Logarithms(v)
 		found := false
@@ -54,3 +60,43 @@ func TestLogarithms(t *testing.T) {
 		}
 	}
 }
+
+// the compressed rows must expand to the rows of the full PFTs.
+func TestCPTRowsMatchPFT(t *testing.T) {
+	maxDegree := 14
+	if testing.Short() {
+		maxDegree = 10
+	}
+	for d := 1; d <= maxDegree; d++ {
+		C, err := New_CPT(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := C.Generate(); err != nil {
+			t.Fatal(err)
+		}
+		for i, lambda := range C.cycleTypes {
+			P, err := NewPFT(d, lambda)
+			if err != nil {
+				t.Fatal(err)
+			}
+			P.Generate()
+			row := &C.rows[i]
+			if row.order != len(P.data) {
+				t.Fatalf("row length; d=%d type=%v expected=%d got=%d", d, &lambda, len(P.data), row.order)
+			}
+			for j, y := range P.data {
+				if x := row.entry(j); x != C.cycleTypeMap[y.Type()] {
+					t.Errorf("entry; d=%d type=%v j=%d expected=%v got=%v", d, &lambda, j, &y, &C.cycleTypes[x])
+				}
+			}
+		}
+		exp, err := NewExpanderV3(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if C.Width().Cmp(exp.Width()) != 0 {
+			t.Errorf("width; d=%d cpt=%v expanderv3=%v", d, C.Width(), exp.Width())
+		}
+	}
+}
@@ -4,6 +4,7 @@ package den
 
 import (
 	"fmt"
+	"math"
 	"math/big"
 	"math/rand"
 	"strings"
@@ -81,24 +82,31 @@ func (t *CycleType) Degree() int {
 	return len(*t)
 }
 
-func (lambda *CycleType) Order() int {
-	present := make([]int, 0)
-	for i, x := range *lambda {
-		if x > 0 {
-			present = append(present, i+1)
-		}
+// Order returns the order of the type as an int, or a DegreeError if
+// it does not fit, as it need not for degrees in the hundreds; see
+// OrderFactorization.
+func (t *CycleType) Order() (int, error) {
+	m, ok := t.OrderFactorization().Int64()
+	if !ok || m > math.MaxInt {
+		return 0, &DegreeError{What: "an int order", Degree: len(*t)}
 	}
-	return LCM(present)
+	return int(m), nil
 }
 
 func (t *CycleType) Orderb(order *big.Int) {
-	present := make([]int, 0)
-	for i, x := range *t {
-		if x > 0 {
-			present = append(present, i + 1)
+	order.Set(t.OrderFactorization().Int())
+}
+
+// OrderFactorization returns the order of the type, the LCM of the
+// cycle lengths present, in factored form, which does not overflow.
+func (t *CycleType) OrderFactorization() Factorization {
+	order := Factorization{}
+	for i, m := range *t {
+		if m > 0 {
+			order = order.LCM(Factor(i + 1))
 		}
 	}
-	LCMb(present, order)
+	return order
 }
 
 func (t *CycleType) PowerOld(k int) *CycleType {
@@ -121,6 +129,38 @@ func (t *CycleType) Power(k int, u CycleType) {
 	}
 }
 
+// PowerFactorization is Power for an exponent given in factored form,
+// so that it may exceed the range of an int.
+func (t *CycleType) PowerFactorization(k Factorization, u CycleType) {
+	for i := range u {
+		u[i] = 0
+	}
+	for i := 1; i <= len(*t); i++ {
+		m := (*t)[i - 1]
+		if m > 0 {
+			f := k.GCDInt(i)
+			u[i/f - 1] += f * m
+		}
+	}
+}
+
+// PowerBig is Power for an arbitrarily large exponent.
+func (t *CycleType) PowerBig(k *big.Int, u CycleType) {
+	for i := range u {
+		u[i] = 0
+	}
+	r := big.NewInt(0)
+	b := big.NewInt(0)
+	for i := 1; i <= len(*t); i++ {
+		m := (*t)[i - 1]
+		if m > 0 {
+			b.SetInt64(int64(i))
+			f := GCD(i, int(r.Mod(k, b).Int64()))
+			u[i/f - 1] += f * m
+		}
+	}
+}
+
 func (t *CycleType) IsIdentity() bool {
 	for i, c := range *t {
 		if i == 0 {
@@ -164,6 +204,8 @@ func (t *CycleType) CardinalityOfCentralizer() *big.Int {
 	return k
 }
 
+// HashKeyString depends on the padding of the slice; Type is the
+// canonical key.
 func (ct *CycleType) HashKeyString() string {
 	return fmt.Sprint(*ct)
 }
@@ -224,7 +266,7 @@ func (ct *CycleType) StringForPartitionWithoutOneCycles() (s string) {
 }
 
 
-// xxx slightly weird; maybe wrap the slice, degree
+// xxx slightly weird; see Type, which wraps the parts and degree
 func (lambda *CycleType) Pad(degree int) CycleType {
 	padded := make([]int, degree)
 	copy(padded, *lambda)
@@ -250,11 +292,10 @@ func (ct *CycleType) PreExtensions() []*CycleType {
 // type that equal the type itself.
 func (t *CycleType) markMethodHeight(height *big.Int) {
 	height.SetInt64(1)
-	bigOne := big.NewInt(1)
-	k := 2
+	k := big.NewInt(2)
 	var u CycleType = make([]int, t.Degree())
 	for {
-		t.Power(k, u)
+		t.PowerBig(k, u)
 		//log.Printf("%v^%v = %v", t, k, &u)
 		if u.IsIdentity() {
 			break
@@ -262,16 +303,13 @@ func (t *CycleType) markMethodHeight(height *big.Int) {
 		if u.Equal(t) {
 			height.Add(height, bigOne)
 		}
-		k++
+		k.Add(k, bigOne)
 	}
 	//log.Printf("t=%v k=%v mark height=%v", t, k, height)
 }
 
 func (t *CycleType) totientMethodHeight(height *big.Int) {
-	order := big.NewInt(0)
-	t.Orderb(order)
-	Totient(order, height)
+	order := t.OrderFactorization()
+	height.Set(order.Totient())
 	//log.Printf("t=%v order=%v totient height=%v", t, order, height)
 }
-
-
@@ -43,7 +43,10 @@ func TestRandomCycleTypeRespectsDegree(t *testing.T) {
 
 func TestOrder(t *testing.T) {
 	tcase := func(lambda CycleType, expected int) {
-		d := lambda.Order()
+		d, err := lambda.Order()
+		if err != nil {
+			t.Fatal(err)
+		}
 		if d != expected {
 			t.Errorf("expected=%v got=%v", expected, d)
 		}
@@ -52,6 +55,16 @@ func TestOrder(t *testing.T) {
 	tcase(*&CycleType{1,1,0,0,1,1}, 30)
 	tcase(*&CycleType{0,2,0,0,1,1}, 30)
 	tcase(*&CycleType{0,2,0,0,1,1,2}, 210)
+
+	// one cycle of each prime length up to 300 has an order beyond 64
+	// bits
+	var ct CycleType = make([]int, 300)
+	for _, p := range Primes(300) {
+		ct[p-1] = 1
+	}
+	if _, err := ct.Order(); err == nil {
+		t.Errorf("expected the order of %v to overflow", &ct)
+	}
 }
 
 func TestPower(t *testing.T) {
@@ -142,7 +155,7 @@ func TestCardinalityOfConjugacyClass(t *testing.T) {
 		}
 		factorial := Factorial(d)
 		if factorial.Cmp(sum) != 0 {
-			t.Errorf("d=%d conjugacy class sum does not equal factorial! expected=%v got=%v", factorial, sum)
+			t.Errorf("d=%d conjugacy class sum does not equal factorial! expected=%v got=%v", d, factorial, sum)
 		}
 	}
 }
@@ -20,6 +20,7 @@ func exit_on_error(f func () error) {
 	var err error = f()
 
 	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
@@ -54,7 +55,9 @@ func process(n int) {
 
 	t0 := time.Now()
 
-	var K *den.CPT = den.New_CPT(n)
+	var K *den.CPT
+
+	exit_on_error(func() (err error) { K, err = den.New_CPT(n); return })
 
 	exit_on_error(func() error { return K.Generate()})
 
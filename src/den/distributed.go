@@ -0,0 +1,640 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"math/bits"
+	"net"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// distributed expansion runs one ExpanderV3 over many processes.  a
+// Coordinator listens for workers, cuts the partitions of n into jobs,
+// ranges of ruleAsc indices, and hands them out one at a time.  an
+// ExpanderWorker expands the types of its job over marks of its own,
+// and sends back the indices it marked and the heights of the types of
+// the job.  the marks are or-ed into the coordinator's table, as for
+// shard files (see shard.go), so it does not matter which worker
+// expands which job, nor how often: the job of a worker that is lost,
+// or that does not answer within the lease, goes back on the queue for
+// another.  once every job is in, the coordinator sums the width.
+//
+// messages are framed by their length and kind; integers are little
+// endian.
+//
+//   frame    length uint32 of what follows, kind byte, payload
+//   hello    worker to coordinator: version uint32, threads uint32
+//   job      coordinator to worker: degree uint32, size uint64, job
+//            uint64, begin uint64, end uint64
+//   result   worker to coordinator: job uint64, begin uint64, end
+//            uint64, transactions uint64, nanoseconds uint64, marks
+//            uint64, then the marked indices ascending as uvarint
+//            deltas, the first from zero, then the heights of the
+//            types of [begin, end) as uvarints
+//   done     coordinator to worker: no payload; the worker exits
+
+const ProtocolVersion = 1
+
+const (
+	msgHello = 1 + iota
+	msgJob
+	msgResult
+	msgDone
+)
+
+const maxFrameSize = 1 << 31
+const helloTimeout = 30 * time.Second
+
+// the number of jobs when no job size is set: enough that workers of
+// different speeds finish close together.
+const defaultJobs = 256
+
+func writeFrame(w *bufio.Writer, kind byte, payload []byte) error {
+	var h [5]byte
+	binary.LittleEndian.PutUint32(h[:], uint32(1+len(payload)))
+	h[4] = kind
+	w.Write(h[:])
+	w.Write(payload)
+	return w.Flush()
+}
+
+func readFrame(r *bufio.Reader) (kind byte, payload []byte, err error) {
+	var h [5]byte
+	if _, err = io.ReadFull(r, h[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.LittleEndian.Uint32(h[:])
+	if n < 1 || n > maxFrameSize {
+		return 0, nil, fmt.Errorf("bad frame length; length=%d", n)
+	}
+	payload = make([]byte, n-1)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return h[4], payload, nil
+}
+
+type distributedJob struct {
+	id int
+	workChunk
+}
+
+func (job distributedJob) encode(degree, size int) []byte {
+	b := make([]byte, 36)
+	binary.LittleEndian.PutUint32(b[0:], uint32(degree))
+	binary.LittleEndian.PutUint64(b[4:], uint64(size))
+	binary.LittleEndian.PutUint64(b[12:], uint64(job.id))
+	binary.LittleEndian.PutUint64(b[20:], uint64(job.begin))
+	binary.LittleEndian.PutUint64(b[28:], uint64(job.end))
+	return b
+}
+
+func decodeJob(b []byte) (job distributedJob, degree, size int, err error) {
+	if len(b) != 36 {
+		return job, 0, 0, fmt.Errorf("bad job message; bytes=%d", len(b))
+	}
+	degree = int(binary.LittleEndian.Uint32(b[0:]))
+	size = int(binary.LittleEndian.Uint64(b[4:]))
+	job.id = int(binary.LittleEndian.Uint64(b[12:]))
+	job.begin = int(binary.LittleEndian.Uint64(b[20:]))
+	job.end = int(binary.LittleEndian.Uint64(b[28:]))
+	if job.begin < 0 || job.begin > job.end || job.end > size {
+		return job, 0, 0, fmt.Errorf("job out of range; begin=%d end=%d size=%d", job.begin, job.end, size)
+	}
+	return job, degree, size, nil
+}
+
+type jobResult struct {
+	distributedJob
+	transactions int
+	elapsed time.Duration
+	marks []int
+	heights []byte
+}
+
+func decodeJobResult(b []byte, size int) (*jobResult, error) {
+	if len(b) < 48 {
+		return nil, fmt.Errorf("bad result message; bytes=%d", len(b))
+	}
+	res := &jobResult{}
+	res.id = int(binary.LittleEndian.Uint64(b[0:]))
+	res.begin = int(binary.LittleEndian.Uint64(b[8:]))
+	res.end = int(binary.LittleEndian.Uint64(b[16:]))
+	res.transactions = int(binary.LittleEndian.Uint64(b[24:]))
+	res.elapsed = time.Duration(binary.LittleEndian.Uint64(b[32:]))
+	numMarks := binary.LittleEndian.Uint64(b[40:])
+	if numMarks > uint64(size) {
+		return nil, fmt.Errorf("too many marks in result; marks=%d size=%d", numMarks, size)
+	}
+	b = b[48:]
+	res.marks = make([]int, numMarks)
+	index := uint64(0)
+	for i := range res.marks {
+		delta, k := binary.Uvarint(b)
+		if k <= 0 || (i > 0 && delta == 0) {
+			return nil, fmt.Errorf("bad mark in result; mark=%d", i)
+		}
+		b = b[k:]
+		index += delta
+		if index >= uint64(size) {
+			return nil, fmt.Errorf("mark out of range in result; index=%d size=%d", index, size)
+		}
+		res.marks[i] = int(index)
+	}
+	res.heights = b
+	for i := res.begin; i < res.end; i++ {
+		h, k := binary.Uvarint(b)
+		if k <= 0 || h == 0 {
+			return nil, fmt.Errorf("bad height in result; index=%d", i)
+		}
+		b = b[k:]
+	}
+	if len(b) != 0 {
+		return nil, fmt.Errorf("extra heights in result; bytes=%d", len(b))
+	}
+	return res, nil
+}
+
+// Coordinator hands out the expansion of one degree to ExpanderWorkers
+// and sums the width.
+type Coordinator struct {
+	degree int
+	listener net.Listener
+	jobSize int
+	lease time.Duration
+	partitionFile string
+	numWorkers int
+	markTable
+	partitions *PartitionStore
+	width *big.Int
+	handlers sync.WaitGroup
+	started time.Time
+	observer Observer
+	progress func(worker, workerDone, done int) // of the expansion
+	partitionsDone int
+
+	mu sync.Mutex
+	cond *sync.Cond
+	pending []distributedJob
+	heights []*heightSlice // by job, nil until the job is in
+	numFinished int
+	remotes []*remoteWorker
+
+	TimeToGeneratePartitions time.Duration
+	TimeToExpand time.Duration
+	TimeToSumWidth time.Duration
+}
+
+// remoteWorker is the coordinator's account of one connection.  the
+// chunks of its result are jobs, and the rate is over the time the
+// worker reports spending on them.
+type remoteWorker struct {
+	index int
+	addr string
+	threads int
+	result workerResult
+	busy time.Duration
+	lost int
+}
+
+// NewCoordinator coordinates the expansion of degree over the workers
+// that connect to l.  Run closes l.
+func NewCoordinator(degree int, l net.Listener) (*Coordinator, error) {
+	if err := checkDegree("coordinator", degree, MaxPartitionStoreDegree); err != nil {
+		return nil, err
+	}
+	c := &Coordinator{degree: degree, listener: l, numWorkers: runtime.NumCPU(), observer: defaultObserver}
+	c.cond = sync.NewCond(&c.mu)
+	return c, nil
+}
+
+func (c *Coordinator) Degree() int {
+	return c.degree
+}
+
+// SetJobSize sets the number of partitions of a job; 0 splits the
+// partitions into about defaultJobs jobs.
+func (c *Coordinator) SetJobSize(n int) {
+	c.jobSize = n
+}
+
+// SetLease sets how long a worker may hold a job before it is taken
+// back and the worker dropped; 0 waits as long as the connection
+// lasts.
+func (c *Coordinator) SetLease(d time.Duration) {
+	c.lease = d
+}
+
+// SetPartitionFile makes the coordinator map its partitions from a
+// file rather than generate them.
+func (c *Coordinator) SetPartitionFile(path string) {
+	c.partitionFile = path
+}
+
+// SetObserver makes the coordinator report to o rather than log; nil
+// restores the log.  the remote workers report on their own side.
+func (c *Coordinator) SetObserver(o Observer) {
+	c.observer = observerOrDefault(o)
+}
+
+// SetNumWorkers sets the local threads used to generate the
+// partitions and sum the width; k < 1 means one per cpu.
+func (c *Coordinator) SetNumWorkers(k int) {
+	if k < 1 {
+		k = runtime.NumCPU()
+	}
+	c.numWorkers = k
+}
+
+func (c *Coordinator) Width() *big.Int {
+	return c.width
+}
+
+func (c *Coordinator) NumMaximalTypes() int {
+	return c.markTable.numUnmarked()
+}
+
+func (c *Coordinator) Density() *big.Rat {
+	return new(big.Rat).SetFrac(c.width, Factorial(c.degree))
+}
+
+// Run serves workers until every job is in, then sums the width.
+func (c *Coordinator) Run() error {
+	defer c.listener.Close()
+	o := c.observer
+	t0 := beginPhase(o, PhaseGeneratingPartitions, c.degree)
+	if c.partitionFile != "" {
+		o.Printf("mapping partitions; n=%d file=%s", c.degree, c.partitionFile)
+		store, err := OpenPartitionFile(c.partitionFile, c.degree)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		c.partitions = store
+	} else {
+		store, err := NewPartitionStoreWithWorkers(c.degree, c.numWorkers)
+		if err != nil {
+			return err
+		}
+		c.partitions = store
+	}
+	size := c.partitions.Len()
+	c.TimeToGeneratePartitions = endPhase(o, PhaseGeneratingPartitions, c.degree, size, t0)
+	c.markTable = newMarkTable(size)
+	jobSize := c.jobSize
+	if jobSize < 1 {
+		jobSize = (size + defaultJobs - 1) / defaultJobs
+	}
+	for begin := 0; begin < size; begin += jobSize {
+		end := begin + jobSize
+		if end > size {
+			end = size
+		}
+		c.pending = append(c.pending, distributedJob{len(c.pending), workChunk{begin, end}})
+	}
+	c.heights = make([]*heightSlice, len(c.pending))
+	o.Printf("coordinating; n=%d parts=%d jobs=%d jobsize=%d addr=%v",
+		c.degree, size, len(c.heights), jobSize, c.listener.Addr())
+
+	c.started = beginPhase(o, PhaseExpanding, c.degree)
+	c.progress = progressReporter(o, PhaseExpanding, c.degree, size)
+	accepted := make(chan struct{})
+	go c.accept(accepted)
+	c.mu.Lock()
+	for c.numFinished < len(c.heights) {
+		c.cond.Wait()
+	}
+	c.mu.Unlock()
+	c.listener.Close()
+	<-accepted
+	c.handlers.Wait()
+	c.TimeToExpand = endPhase(o, PhaseExpanding, c.degree, size, c.started)
+	for _, rw := range c.remotes {
+		o.Printf("remote worker %d; addr=%s threads=%d lost=%d", rw.index, rw.addr, rw.threads, rw.lost)
+		o.Worker(WorkerEvent{
+			Phase: PhaseExpanding,
+			Degree: c.degree,
+			Worker: rw.index,
+			Transactions: rw.result.transactionCount,
+			Rate: rw.result.transactionRate,
+			Chunks: rw.result.chunkCount,
+			Finished: rw.result.timeToFinish,
+		})
+	}
+
+	t1 := beginPhase(o, PhaseSummingWidth, c.degree)
+	width, err := sumSliceWidths(c.degree, c.heights, c.markTable, c.partitions, c.numWorkers)
+	if err != nil {
+		return err
+	}
+	c.width = width
+	c.TimeToSumWidth = endPhase(o, PhaseSummingWidth, c.degree, size, t1)
+	o.Printf("width; n=%d width=%v swtime=%v", c.degree, width, int(c.TimeToSumWidth.Seconds()))
+	return nil
+}
+
+func (c *Coordinator) accept(accepted chan<- struct{}) {
+	defer close(accepted)
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+		c.handlers.Add(1)
+		go c.serve(conn)
+	}
+}
+
+// serve hands jobs to one worker until there are none left, or the
+// worker is lost.
+func (c *Coordinator) serve(conn net.Conn) {
+	defer c.handlers.Done()
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	addr := conn.RemoteAddr().String()
+	conn.SetReadDeadline(time.Now().Add(helloTimeout))
+	kind, payload, err := readFrame(r)
+	if err == nil && (kind != msgHello || len(payload) != 8) {
+		err = fmt.Errorf("expected hello; kind=%d", kind)
+	}
+	if err == nil {
+		if v := binary.LittleEndian.Uint32(payload); v != ProtocolVersion {
+			err = fmt.Errorf("unsupported protocol version; version=%d supported=%d", v, ProtocolVersion)
+		}
+	}
+	if err != nil {
+		c.observer.Printf("rejected worker; addr=%s err=%v", addr, err)
+		return
+	}
+	rw := c.addRemote(addr, int(binary.LittleEndian.Uint32(payload[4:])))
+	c.observer.Printf("worker joined; worker=%d addr=%s threads=%d", rw.index, addr, rw.threads)
+	for {
+		job, ok := c.takeJob()
+		if !ok {
+			break
+		}
+		if err := c.runJob(conn, r, w, job, rw); err != nil {
+			c.giveBack(job, rw)
+			c.observer.Printf("lost worker; worker=%d addr=%s job=%d begin=%d end=%d err=%v",
+				rw.index, addr, job.id, job.begin, job.end, err)
+			return
+		}
+	}
+	conn.SetWriteDeadline(time.Now().Add(helloTimeout))
+	writeFrame(w, msgDone, nil)
+	c.mu.Lock()
+	rw.result.timeToFinish = time.Since(c.started)
+	c.mu.Unlock()
+}
+
+func (c *Coordinator) addRemote(addr string, threads int) *remoteWorker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rw := &remoteWorker{index: len(c.remotes), addr: addr, threads: threads}
+	c.remotes = append(c.remotes, rw)
+	return rw
+}
+
+// takeJob waits for a job; while others hold the last jobs it waits
+// for them to finish or be given back.
+func (c *Coordinator) takeJob() (distributedJob, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.pending) == 0 && c.numFinished < len(c.heights) {
+		c.cond.Wait()
+	}
+	if len(c.pending) == 0 {
+		return distributedJob{}, false
+	}
+	job := c.pending[0]
+	c.pending = c.pending[1:]
+	return job, true
+}
+
+func (c *Coordinator) giveBack(job distributedJob, rw *remoteWorker) {
+	c.mu.Lock()
+	c.pending = append(c.pending, job)
+	rw.lost++
+	c.mu.Unlock()
+	c.cond.Broadcast()
+}
+
+func (c *Coordinator) runJob(conn net.Conn, r *bufio.Reader, w *bufio.Writer, job distributedJob, rw *remoteWorker) error {
+	deadline := time.Time{}
+	if c.lease > 0 {
+		deadline = time.Now().Add(c.lease)
+	}
+	conn.SetDeadline(deadline)
+	if err := writeFrame(w, msgJob, job.encode(c.degree, c.markTable.size)); err != nil {
+		return err
+	}
+	kind, payload, err := readFrame(r)
+	if err != nil {
+		return err
+	}
+	if kind != msgResult {
+		return fmt.Errorf("expected result; kind=%d", kind)
+	}
+	res, err := decodeJobResult(payload, c.markTable.size)
+	if err != nil {
+		return err
+	}
+	if res.distributedJob != job {
+		return fmt.Errorf("result for the wrong job; expected=%d [%d, %d) got=%d [%d, %d)",
+			job.id, job.begin, job.end, res.id, res.begin, res.end)
+	}
+	c.complete(res, rw)
+	return nil
+}
+
+// complete ors the marks of a job into the table and keeps its
+// heights; a job done twice counts once.
+func (c *Coordinator) complete(res *jobResult, rw *remoteWorker) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rw.result.transactionCount += res.transactions
+	rw.result.chunkCount++
+	rw.busy += res.elapsed
+	if seconds := rw.busy.Seconds(); seconds > 0 {
+		rw.result.transactionRate = float64(rw.result.transactionCount) / seconds
+	}
+	if c.heights[res.id] != nil {
+		return
+	}
+	for _, i := range res.marks {
+		c.markTable.mark(i)
+	}
+	c.heights[res.id] = &heightSlice{
+		begin: res.begin,
+		end: res.end,
+		heights: res.heights,
+		source: fmt.Sprintf("job %d from %s", res.id, rw.addr),
+	}
+	c.numFinished++
+	c.partitionsDone += res.end - res.begin
+	c.progress(rw.index, res.end-res.begin, c.partitionsDone)
+	if c.numFinished == len(c.heights) {
+		c.cond.Broadcast()
+	}
+}
+
+// ExpanderWorker expands the jobs of a Coordinator.
+type ExpanderWorker struct {
+	addr string
+	numWorkers int
+	partitionFile string
+	exp *ExpanderV3
+	observer Observer
+}
+
+func NewExpanderWorker(addr string) *ExpanderWorker {
+	return &ExpanderWorker{addr: addr, numWorkers: runtime.NumCPU(), observer: defaultObserver}
+}
+
+// SetObserver makes the worker and the expanders of its jobs report to
+// o rather than log; nil restores the log.
+func (w *ExpanderWorker) SetObserver(o Observer) {
+	w.observer = observerOrDefault(o)
+}
+
+// SetNumWorkers sets the threads that expand a job; k < 1 means one
+// per cpu.
+func (w *ExpanderWorker) SetNumWorkers(k int) {
+	if k < 1 {
+		k = runtime.NumCPU()
+	}
+	w.numWorkers = k
+}
+
+// SetPartitionFile makes the worker map its partitions from a file
+// rather than generate them.
+func (w *ExpanderWorker) SetPartitionFile(path string) {
+	w.partitionFile = path
+}
+
+// Run connects to the coordinator and expands jobs until it is told
+// there are no more.
+func (w *ExpanderWorker) Run() error {
+	conn, err := net.Dial("tcp", w.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	defer func() {
+		if w.exp != nil {
+			w.exp.Close()
+			w.exp = nil
+		}
+	}()
+	r := bufio.NewReader(conn)
+	bw := bufio.NewWriter(conn)
+	hello := make([]byte, 8)
+	binary.LittleEndian.PutUint32(hello[0:], ProtocolVersion)
+	binary.LittleEndian.PutUint32(hello[4:], uint32(w.numWorkers))
+	if err := writeFrame(bw, msgHello, hello); err != nil {
+		return err
+	}
+	w.observer.Printf("joined coordinator; addr=%s threads=%d", w.addr, w.numWorkers)
+	for {
+		kind, payload, err := readFrame(r)
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case msgDone:
+			w.observer.Printf("coordinator done; addr=%s", w.addr)
+			return nil
+		case msgJob:
+			result, err := w.runJob(payload)
+			if err != nil {
+				return err
+			}
+			if err := writeFrame(bw, msgResult, result); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected message; kind=%d", kind)
+		}
+	}
+}
+
+// runJob expands a job over cleared marks and encodes its result.
+func (w *ExpanderWorker) runJob(payload []byte) ([]byte, error) {
+	job, degree, size, err := decodeJob(payload)
+	if err != nil {
+		return nil, err
+	}
+	if w.exp == nil || w.exp.degree != degree {
+		if w.exp != nil {
+			w.exp.Close()
+			w.exp = nil
+		}
+		exp, err := NewExpanderV3(degree)
+		if err != nil {
+			return nil, err
+		}
+		exp.SetNumWorkers(w.numWorkers)
+		exp.SetPartitionFile(w.partitionFile)
+		exp.SetObserver(w.observer)
+		if err := exp.ensureSortedPartitions(); err != nil {
+			return nil, err
+		}
+		exp.ensureMarkTable()
+		w.exp = exp
+	}
+	exp := w.exp
+	if exp.partitions.Len() != size {
+		return nil, fmt.Errorf("job does not match the partitions; n=%d size=%d partitions=%d",
+			degree, size, exp.partitions.Len())
+	}
+	w.observer.Printf("expanding job; n=%d job=%d begin=%d end=%d", degree, job.id, job.begin, job.end)
+	exp.resetMarkTable()
+	t0 := time.Now()
+	if err := exp.expandRange(job.begin, job.end); err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(t0)
+	transactions := 0
+	for _, worker := range exp.workers {
+		transactions += worker.result.transactionCount
+	}
+
+	var b bytes.Buffer
+	var word [binary.MaxVarintLen64]byte
+	for _, x := range []int{job.id, job.begin, job.end, transactions, int(elapsed), exp.markTable.numMarks()} {
+		binary.LittleEndian.PutUint64(word[:], uint64(x))
+		b.Write(word[:8])
+	}
+	last := 0
+	for i, x := range exp.markTable.bits {
+		for x != 0 {
+			index := 64*i + bits.TrailingZeros64(x)
+			b.Write(word[:binary.PutUvarint(word[:], uint64(index-last))])
+			last = index
+			x &= x - 1
+		}
+	}
+	if err := exp.writeHeights(&b, job.begin, job.end); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// expandRange expands the partitions of [begin, end) over the marks in
+// hand, for a remote worker.
+func (exp *ExpanderV3) expandRange(begin, end int) error {
+	exp.spawnWorkers()
+	exp.distributeWork(begin, end)
+	err := exp.closeWorkers()
+	exp.progress = nil
+	return err
+}
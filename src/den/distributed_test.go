@@ -0,0 +1,207 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func listenLocal(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// runWorkers starts k workers against the coordinator and returns a
+// function that waits for them.
+func runWorkers(t *testing.T, addr string, k int) (wait func()) {
+	var wg sync.WaitGroup
+	for i := 0; i < k; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := NewExpanderWorker(addr)
+			w.SetNumWorkers(2)
+			if err := w.Run(); err != nil {
+				t.Errorf("worker: %v", err)
+			}
+		}()
+	}
+	return wg.Wait
+}
+
+func checkCoordinator(t *testing.T, c *Coordinator) {
+	exp, err := NewExpanderV3(c.Degree())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Width().Cmp(exp.Width()) != 0 || c.NumMaximalTypes() != exp.NumMaximalTypes() ||
+		c.Density().Cmp(exp.Density()) != 0 {
+		t.Errorf("d=%d; expected width=%v maximal=%d got width=%v maximal=%d",
+			c.Degree(), exp.Width(), exp.NumMaximalTypes(), c.Width(), c.NumMaximalTypes())
+	}
+}
+
+func TestDistributedExpansionMatchesUnbrokenRun(t *testing.T) {
+	maxDegree := 30
+	if testing.Short() {
+		maxDegree = 22
+	}
+	for d := 1; d <= maxDegree; d += 3 {
+		l := listenLocal(t)
+		c, err := NewCoordinator(d, l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetNumWorkers(2)
+		c.SetJobSize(int(PartitionNumber(d).Int64())/7 + 1)
+		wait := runWorkers(t, l.Addr().String(), 3)
+		if err := c.Run(); err != nil {
+			t.Fatalf("d=%d: %v", d, err)
+		}
+		wait()
+		checkCoordinator(t, c)
+		jobs := 0
+		for _, rw := range c.remotes {
+			jobs += rw.result.chunkCount
+		}
+		if jobs != len(c.heights) {
+			t.Errorf("d=%d; expected jobs=%d got=%d", d, len(c.heights), jobs)
+		}
+	}
+}
+
+func TestCoordinatorObserver(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	d := 18
+	l := listenLocal(t)
+	c, err := NewCoordinator(d, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := newRecordingObserver()
+	c.SetObserver(o)
+	c.SetNumWorkers(2)
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := NewExpanderWorker(l.Addr().String())
+			w.SetNumWorkers(2)
+			w.SetObserver(DiscardObserver{})
+			if err := w.Run(); err != nil {
+				t.Errorf("worker: %v", err)
+			}
+		}()
+	}
+	if err := c.Run(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	expected := fmt.Sprint([]string{
+		"begin " + PhaseGeneratingPartitions, "done " + PhaseGeneratingPartitions,
+		"begin " + PhaseExpanding, "done " + PhaseExpanding,
+		"begin " + PhaseSummingWidth, "done " + PhaseSummingWidth,
+	})
+	if got := fmt.Sprint(o.phases); got != expected {
+		t.Errorf("expected phases=%s got=%s", expected, got)
+	}
+	size := c.partitions.Len()
+	if e := o.progress[PhaseExpanding]; e.Done != size || e.Total != size {
+		t.Errorf("expected done=total=%d got %+v", size, e)
+	}
+	if len(o.workers) != len(c.remotes) {
+		t.Errorf("expected %d worker events got %d", len(c.remotes), len(o.workers))
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no log output; got %q", buf.String())
+	}
+}
+
+// badWorker takes one job and then, rather than answer, hangs up or
+// stalls until the coordinator drops it.
+func badWorker(t *testing.T, addr string, stall bool) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	hello := make([]byte, 8)
+	binary.LittleEndian.PutUint32(hello, ProtocolVersion)
+	if err := writeFrame(bufio.NewWriter(conn), msgHello, hello); err != nil {
+		t.Fatal(err)
+	}
+	if kind, _, err := readFrame(r); err != nil || kind != msgJob {
+		t.Fatalf("expected job; kind=%d err=%v", kind, err)
+	}
+	if stall {
+		readFrame(r)
+	}
+}
+
+func TestCoordinatorReissuesLostWork(t *testing.T) {
+	d := 20
+	for _, stall := range []bool{false, true} {
+		l := listenLocal(t)
+		c, err := NewCoordinator(d, l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetNumWorkers(2)
+		c.SetJobSize(50)
+		if stall {
+			c.SetLease(200 * time.Millisecond)
+		}
+		done := make(chan error)
+		go func() {
+			done <- c.Run()
+		}()
+		badWorker(t, l.Addr().String(), stall)
+		wait := runWorkers(t, l.Addr().String(), 2)
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		wait()
+		checkCoordinator(t, c)
+		if c.remotes[0].lost != 1 || c.remotes[0].result.chunkCount != 0 {
+			t.Errorf("stall=%v; expected the bad worker to lose its job; lost=%d jobs=%d",
+				stall, c.remotes[0].lost, c.remotes[0].result.chunkCount)
+		}
+	}
+}
+
+func TestDecodeJobResultChecksMarks(t *testing.T) {
+	tcase := func(marks []uint64, ok bool) {
+		b := make([]byte, 48)
+		binary.LittleEndian.PutUint64(b[40:], uint64(len(marks)))
+		var word [binary.MaxVarintLen64]byte
+		for _, x := range marks {
+			b = append(b, word[:binary.PutUvarint(word[:], x)]...)
+		}
+		_, err := decodeJobResult(b, 10)
+		if (err == nil) != ok {
+			t.Errorf("marks=%v expected ok=%v got err=%v", marks, ok, err)
+		}
+	}
+	tcase(nil, true)
+	tcase([]uint64{0, 3, 6}, true)
+	tcase([]uint64{9}, true)
+	tcase([]uint64{10}, false)
+	tcase([]uint64{4, 0}, false)
+	tcase([]uint64{5, 5}, false)
+}
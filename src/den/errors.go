@@ -0,0 +1,141 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// the constructors validate their arguments and return these rather
+// than crash later, or compute nonsense.  callers that want the cause
+// use errors.As.
+
+// DegreeError is a degree out of the range something supports.
+type DegreeError struct {
+	What string // what was asked for, e.g. "ExpanderV3"
+	Degree int
+	Max int // 0 for no bound beyond the int range
+}
+
+func (e *DegreeError) Error() string {
+	if e.Max > 0 {
+		return fmt.Sprintf("degree out of range for %s; degree=%d min=1 max=%d", e.What, e.Degree, e.Max)
+	}
+	return fmt.Sprintf("degree out of range for %s; degree=%d min=1", e.What, e.Degree)
+}
+
+func checkDegree(what string, degree, max int) error {
+	if degree < 1 || (max > 0 && degree > max) {
+		return &DegreeError{What: what, Degree: degree, Max: max}
+	}
+	return nil
+}
+
+// CycleTypeError is a cycle type that is not one of its degree.
+type CycleTypeError struct {
+	Degree int
+	Type CycleType
+	Reason string
+}
+
+func (e *CycleTypeError) Error() string {
+	return fmt.Sprintf("bad cycle type; degree=%d type=%v: %s", e.Degree, []int(e.Type), e.Reason)
+}
+
+// checkCycleType accepts a sagan cycle type of the degree, which may be
+// short, or padded with zeros past it.
+func checkCycleType(t CycleType, degree int) error {
+	sum := 0
+	for i, m := range t {
+		if m < 0 {
+			return &CycleTypeError{degree, t, fmt.Sprintf("negative count of %d-cycles", i+1)}
+		}
+		if m > 0 && i >= degree {
+			return &CycleTypeError{degree, t, fmt.Sprintf("%d-cycles are longer than the degree", i+1)}
+		}
+		sum += (i + 1) * m
+		if sum > degree {
+			return &CycleTypeError{degree, t, "cycles sum past the degree"}
+		}
+	}
+	if sum != degree {
+		return &CycleTypeError{degree, t, fmt.Sprintf("cycles sum to %d", sum)}
+	}
+	return nil
+}
+
+// CheckError is a broken invariant of a table, found by its Check.
+type CheckError struct {
+	Table string
+	Degree int
+	Row, Column int // -1 where they do not apply
+	Reason string
+}
+
+func (e *CheckError) Error() string {
+	return fmt.Sprintf("%s check failed; n=%d row=%d column=%d: %s", e.Table, e.Degree, e.Row, e.Column, e.Reason)
+}
+
+// WorkerPanicError is the panic of a worker goroutine, recovered and
+// returned by the computation that started the worker.
+type WorkerPanicError struct {
+	Worker int
+	Value interface{}
+	Stack []byte
+}
+
+func (e *WorkerPanicError) Error() string {
+	return fmt.Sprintf("worker %d panicked: %v", e.Worker, e.Value)
+}
+
+// workerPanics keeps the first panic of a set of workers.  a worker
+// defers catch, and the others see failed and stop taking work.
+type workerPanics struct {
+	mu sync.Mutex
+	err *WorkerPanicError
+	failing int32
+}
+
+func (w *workerPanics) catch(worker int) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	atomic.StoreInt32(&w.failing, 1)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = &WorkerPanicError{Worker: worker, Value: v, Stack: debug.Stack()}
+	}
+}
+
+func (w *workerPanics) failed() bool {
+	return atomic.LoadInt32(&w.failing) != 0
+}
+
+// result is the first panic, or nil.
+func (w *workerPanics) result() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		return nil
+	}
+	return w.err
+}
+
+// ErrSharded is returned for a result that a sharded expander does not
+// have; the shard files are merged for it.
+var ErrSharded = errors.New("sharded expander has no result of its own; merge the shard files")
+
+// UnknownEngineError is an engine that NewResourcePlan cannot plan.
+type UnknownEngineError struct {
+	Engine string
+}
+
+func (e *UnknownEngineError) Error() string {
+	return fmt.Sprintf("unknown engine to plan; engine=%s engines=%v", e.Engine, PlanEngines)
+}
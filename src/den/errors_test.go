@@ -0,0 +1,167 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestConstructorsRejectBadDegrees(t *testing.T) {
+	type tcase struct {
+		name string
+		max int // 0 for none
+		construct func(d int) error
+	}
+	errorOf := func(_ interface{}, err error) error { return err }
+	tcases := []tcase{
+		tcase{"ExpanderV3", MaxPartitionStoreDegree, func(d int) error { return errorOf(NewExpanderV3(d)) }},
+		tcase{"ExpanderV4", 0, func(d int) error { return errorOf(NewExpanderV4(d)) }},
+		tcase{"Expander", 0, func(d int) error { return errorOf(NewExpander(d)) }},
+		tcase{"CPT", MaxTypeDegree, func(d int) error { return errorOf(New_CPT(d)) }},
+		tcase{"PFT", 0, func(d int) error { return errorOf(NewPFT(d, CycleType{})) }},
+		tcase{"abel table", MaxPartitionStoreDegree, func(d int) error { return errorOf(NewAbelTable(d)) }},
+		tcase{"plan", 0, func(d int) error { return errorOf(NewResourcePlan("CPT", d)) }},
+		tcase{"coordinator", MaxPartitionStoreDegree, func(d int) error { return errorOf(NewCoordinator(d, nil)) }},
+		tcase{"partition store", MaxPartitionStoreDegree, func(d int) error { return errorOf(NewPartitionStore(d)) }},
+		tcase{"partition ranker", maxRankableDegree, func(d int) error { return errorOf(NewPartitionRanker(d)) }},
+	}
+	for _, c := range tcases {
+		degrees := []int{0, -3}
+		if c.max > 0 {
+			degrees = append(degrees, c.max+1)
+		}
+		for _, d := range degrees {
+			var e *DegreeError
+			if err := c.construct(d); !errors.As(err, &e) || e.Degree != d {
+				t.Errorf("%s; d=%d expected a *DegreeError got %v", c.name, d, err)
+			}
+		}
+	}
+	if _, err := NewResourcePlan("ExpanderV2", 10); err == nil {
+		t.Errorf("expected an error for an unknown engine")
+	} else if _, ok := err.(*UnknownEngineError); !ok {
+		t.Errorf("expected an *UnknownEngineError got %v", err)
+	}
+}
+
+func TestNewPFTChecksLambda(t *testing.T) {
+	type tcase struct {
+		degree int
+		lambda CycleType
+		expected string // "" for a good type
+	}
+	tcases := []tcase{
+		tcase{5, CycleType{1, 2}, ""},
+		tcase{5, CycleType{0, 1, 1}, ""},
+		tcase{5, CycleType{5, 0, 0, 0, 0, 0, 0}, ""},
+		tcase{5, CycleType{1, 1, 1}, "sum past the degree"},
+		tcase{5, CycleType{1, 1}, "sum to 3"},
+		tcase{5, CycleType{3, -1}, "negative"},
+		tcase{3, CycleType{0, 0, 0, 1}, "longer than the degree"},
+	}
+	for _, c := range tcases {
+		_, err := NewPFT(c.degree, c.lambda)
+		var e *CycleTypeError
+		if c.expected == "" {
+			if err != nil {
+				t.Errorf("d=%d lambda=%v unexpected error %v", c.degree, []int(c.lambda), err)
+			}
+		} else if !errors.As(err, &e) || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("d=%d lambda=%v expected error containing %q got %v", c.degree, []int(c.lambda), c.expected, err)
+		}
+	}
+}
+
+func TestExpandReturnsWorkerPanic(t *testing.T) {
+	exp, err := NewExpanderV3(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.SetNumWorkers(3)
+	exp.SetObserver(DiscardObserver{})
+	exp.onChunk = func() { panic("boom") }
+	err = exp.Expand()
+	var e *WorkerPanicError
+	if !errors.As(err, &e) || e.Value != "boom" || len(e.Stack) == 0 {
+		t.Fatalf("expected a *WorkerPanicError of boom got %v", err)
+	}
+	if _, err := exp.WidthContext(context.Background()); !errors.As(err, &e) {
+		t.Errorf("expected the width to fail the same way; got %v", err)
+	}
+}
+
+func TestCPTCheck(t *testing.T) {
+	maxDegree := 14
+	if testing.Short() {
+		maxDegree = 10
+	}
+	for d := 1; d <= maxDegree; d++ {
+		cpt, err := New_CPT(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cpt.SetObserver(DiscardObserver{})
+		if err := cpt.Generate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := cpt.Check(); err != nil {
+			t.Errorf("d=%d unexpected error %v", d, err)
+		}
+	}
+
+	d := 8
+	type tcase struct {
+		name string
+		corrupt func(cpt *CPT, r int) // r is a row of order 3
+		expected string
+	}
+	tcases := []tcase{
+		tcase{"not generated", func(cpt *CPT, r int) { cpt.rows = nil }, "not generated"},
+		tcase{"row count", func(cpt *CPT, r int) { cpt.rows = cpt.rows[1:] }, "rows="},
+		tcase{"type", func(cpt *CPT, r int) { cpt.cycleTypes[r][0]++ }, "bad cycle type"},
+		tcase{"row 0", func(cpt *CPT, r int) { cpt.rows[r].images[0].index = r + 1 }, "begin with the type itself"},
+		tcase{"order", func(cpt *CPT, r int) { cpt.rows[r].order = 6 }, "lcm 3"},
+		tcase{"divisors", func(cpt *CPT, r int) { cpt.rows[r].images = cpt.rows[r].images[:1] }, "divisors"},
+		tcase{"image", func(cpt *CPT, r int) { cpt.rows[r].images[1].index = r }, "image of order"},
+		tcase{"multiplicity", func(cpt *CPT, r int) { cpt.rows[r].images[0].multiplicity = 1 }, "multiplicity"},
+	}
+	for _, c := range tcases {
+		cpt, err := New_CPT(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cpt.SetObserver(DiscardObserver{})
+		if err := cpt.Generate(); err != nil {
+			t.Fatal(err)
+		}
+		r := 0
+		for cpt.rows[r].order != 3 {
+			r++
+		}
+		c.corrupt(cpt, r)
+		err = cpt.Check()
+		var e *CheckError
+		if !errors.As(err, &e) || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("%s; expected error containing %q got %v", c.name, c.expected, err)
+		}
+	}
+}
+
+func TestPFTCheck(t *testing.T) {
+	P, err := NewPFT(9, CycleType{0, 2, 0, 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	P.Generate()
+	if err := P.Check(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	P.data[3][1]++
+	var e *CheckError
+	if err := P.Check(); !errors.As(err, &e) || e.Row != 3 {
+		t.Errorf("expected a *CheckError of row 3 got %v", err)
+	}
+}
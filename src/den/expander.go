@@ -62,8 +62,11 @@ func (types SortableCycleTypes) Swap(i, j int) {
 	types[j] = t
 }
 
-func NewExpander(degree int) *Expander {
-	return &Expander{degree: degree}
+func NewExpander(degree int) (*Expander, error) {
+	if err := checkDegree("Expander", degree, 0); err != nil {
+		return nil, err
+	}
+	return &Expander{degree: degree}, nil
 }
 
 func (exp *Expander) Degree() int {
@@ -81,10 +84,9 @@ func (exp *Expander) generateAllCycleTypes() []MarkedCycleType {
 	t0 := time.Now()
 	k := exp.CountAllPartitions()
 	types := make([]MarkedCycleType, k)
-	var yield chan Partition = YieldAllPartitions(exp.degree)
 	i := 0
-	for p := range yield {
-		types[i].CycleType = p.CycleTypeOld()
+	for it := NewPartitionIterator(exp.degree, nil); it.Next(); {
+		types[i].CycleType = it.Partition().CycleTypeOld()
 		i++
 	}
 	exp.TimeToGenerateCycleTypes = time.Since(t0)
@@ -100,13 +102,10 @@ func (exp *Expander) AllPartitions() []MarkedPartition {
 
 func (exp *Expander) generateAllPartitions() []MarkedPartition {
 	t0 := time.Now()
-	k := exp.CountAllPartitions()
-	partitions := make([]MarkedPartition, k)
-	var yield chan Partition = YieldAllPartitions(exp.degree)
-	i := 0
-	for p := range yield {
+	all := AllPartitions(exp.degree)
+	partitions := make([]MarkedPartition, len(all))
+	for i, p := range all {
 		partitions[i].Partition = p
-		i++
 	}
 	exp.TimeToGeneratePartitions = time.Since(t0)
 	return partitions
@@ -114,11 +113,7 @@ func (exp *Expander) generateAllPartitions() []MarkedPartition {
 
 func (exp *Expander) CountAllPartitions() int {
 	t0 := time.Now()
-	var yield chan Partition = YieldAllPartitions(exp.degree)
-	i := 0
-	for range yield {
-		i++
-	}
+	i := CountAllPartitions(exp.degree)
 	exp.TimeToCountPartitions = time.Since(t0)
 	return i
 }
@@ -4,18 +4,172 @@ package main
 
 import (
 	"den"
+	"errors"
 	"flag"
 	"fmt"
+	"log"
+	"net"
+	"os"
+	"time"
 )
 
 func main() {
 	var degree int
+	var workers int
+	var partitionFile string
+	var memory string
+	var checkpoint string
+	var every time.Duration
+	var resume bool
+	var shard string
+	var shardOut string
+	var listen string
+	var connect string
+	var jobSize int
+	var lease time.Duration
+	var quiet bool
+	var metricsAddr string
+	var report string
 
 	flag.IntVar(&degree, "n", 7, "degree of symmetric group")
+	flag.IntVar(&workers, "workers", 0, "number of workers (0 for one per cpu)")
+	flag.StringVar(&partitionFile, "partitions", "", "partition file to map (see gen-partition-file)")
+	flag.StringVar(&memory, "mem", "", "memory budget, e.g. 8G")
+	flag.StringVar(&checkpoint, "checkpoint", "", "checkpoint file, written periodically and on SIGINT")
+	flag.DurationVar(&every, "checkpoint-every", den.DefaultCheckpointInterval, "interval between checkpoints")
+	flag.BoolVar(&resume, "resume", false, "continue from the checkpoint (default file checkpoint-<n>.den)")
+	flag.StringVar(&shard, "shard", "", "expand only shard i/k of the partitions and write a shard file (see merge-shards)")
+	flag.StringVar(&shardOut, "shard-out", "", "shard file (default shard-<n>-<i>-of-<k>.den)")
+	flag.StringVar(&listen, "listen", "", "coordinate remote workers on this address, e.g. :7070")
+	flag.StringVar(&connect, "connect", "", "work for the coordinator at this address")
+	flag.IntVar(&jobSize, "job-size", 0, "partitions per job of a coordinator (0 for about 256 jobs)")
+	flag.DurationVar(&lease, "lease", 0, "time a worker may hold a job before it is given to another (0 for no limit)")
+	flag.BoolVar(&quiet, "quiet", false, "do not log the progress of the expander")
+	flag.StringVar(&metricsAddr, "metrics", "", "serve live metrics on this address, e.g. localhost:9090")
+	flag.StringVar(&report, "report", "", "write a json run report to this file at the end")
 	flag.Parse()
 
-	exp := den.NewExpanderV3(degree)
-	exp.NumMaximalTypes()
+	var observer den.Observer
+	if quiet {
+		observer = den.DiscardObserver{}
+	}
+	metrics, err := den.StartMetrics(observer, metricsAddr, report)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if metrics != nil {
+		observer = metrics
+	}
+	defer func() {
+		if err := metrics.WriteReport(report); err != nil {
+			log.Print(err)
+		}
+	}()
 
-	fmt.Print(exp.String())
+	if connect != "" {
+		w := den.NewExpanderWorker(connect)
+		w.SetNumWorkers(workers)
+		w.SetPartitionFile(partitionFile)
+		w.SetObserver(observer)
+		if err := w.Run(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if listen != "" {
+		coordinate(degree, listen, workers, partitionFile, jobSize, lease, observer)
+		return
+	}
+
+	if resume && checkpoint == "" {
+		checkpoint = den.CheckpointPath(".", degree)
+	}
+
+	exp, err := den.NewExpanderV3(degree)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exp.SetNumWorkers(workers)
+	exp.SetPartitionFile(partitionFile)
+	exp.SetObserver(observer)
+	if memory != "" {
+		budget, err := den.ParseByteSize(memory)
+		if err != nil {
+			log.Fatal(err)
+		}
+		exp.SetMemoryBudget(budget)
+	}
+	if checkpoint != "" {
+		exp.SetCheckpoint(checkpoint, every)
+		exp.SetInterrupt(den.InterruptOnSignal())
+	}
+	if resume {
+		exp.ResumeFrom(checkpoint)
+	}
+	if shard != "" {
+		i, k, err := den.ParseShard(shard)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if shardOut == "" {
+			shardOut = den.ShardFilePath(".", degree, i, k)
+		}
+		if err := exp.SetShard(i, k); err != nil {
+			log.Fatal(err)
+		}
+		check(exp.WriteShardFile(shardOut), metrics, report)
+		if err := exp.RemoveCheckpoint(); err != nil {
+			log.Print(err)
+		}
+		return
+	}
+	check(exp.Expand(), metrics, report)
+
+	if _, err := exp.WriteTo(os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+	if err := exp.RemoveCheckpoint(); err != nil {
+		log.Print(err)
+	}
+}
+
+// coordinate hands the expansion out to the workers started with
+// -connect and prints the result as merge-shards does.
+func coordinate(degree int, addr string, workers int, partitionFile string, jobSize int, lease time.Duration,
+	observer den.Observer) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c, err := den.NewCoordinator(degree, l)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c.SetNumWorkers(workers)
+	c.SetPartitionFile(partitionFile)
+	c.SetJobSize(jobSize)
+	c.SetLease(lease)
+	c.SetObserver(observer)
+	if err := c.Run(); err != nil {
+		log.Fatal(err)
+	}
+	density, _ := c.Density().Float64()
+	fmt.Printf("#n NumMaximalTypesV3 WidthV3 DensityV3\n")
+	fmt.Printf("%d %d %v %v\n", degree, c.NumMaximalTypes(), c.Width(), density)
+}
+
+// check exits on err.  an interrupted expander has written its
+// checkpoint, so the report is written too, and the exit status is that
+// of a SIGINT.
+func check(err error, metrics *den.Metrics, report string) {
+	if errors.Is(err, den.ErrInterrupted) {
+		if err := metrics.WriteReport(report); err != nil {
+			log.Print(err)
+		}
+		log.Printf("stopped at checkpoint; continue with -resume")
+		os.Exit(130)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 }
@@ -3,11 +3,14 @@
 package den
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"io"
 	"math/big"
+	"math/bits"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,95 +22,227 @@ type ExpanderV3 struct
 	degree int
 	expanded bool
 	markTable
-	sortedPartitions SortablePartitions
+	partitions *PartitionStore
 	wg sync.WaitGroup
 	width *big.Int
+	numWorkers int
+	firstNew int // partitions before this were expanded at degree-1
+	shard, shards int // see SetShard
+	partitionFile string
+	memoryBudget int64
+	queues []*workQueue
+	progress *chunkProgress
+	types *typeTables
 	workers []*expanderV3Worker
+	checkpointPath string
+	checkpointInterval time.Duration
+	interrupt <-chan struct{}
+	resumePath string
+	resumed *checkpoint // of a width phase, until the width is summed
+	onChunk func() // called as each chunk completes; for tests
+	observer Observer
+	panics *workerPanics // of the phase in hand
 
 	TimeToGeneratePartitions time.Duration
-	TimeToDistributeWork time.Duration
+	TimeToDistributeWork time.Duration // to deal the chunks to the queues and start the workers
 	TimeToWaitForWorkers time.Duration
 	TimeToExpand time.Duration
 	TimeToSumWidth time.Duration
 	TimeTotalToComputeWidth time.Duration
-}
 
-type markTable []typeMark // indices correspond between markTable and sortedPartitions
+	// scheduling of the last expansion: the chunks the workers stole
+	// from each other's queues, and the time they sat idle between
+	// finishing and the last of them finishing, summed over workers.
+	Steals int
+	TimeWorkersIdle time.Duration
+}
 
-type typeMark struct {
-	marked bool // if marked, indicates that some other type
-		    // raised to some power equals this type.
+// markTable is a bitset with one bit per partition; indices
+// correspond between markTable and partitions.  a set bit indicates
+// that some other type raised to some power equals this type.  bits
+// are set with compare-and-swap, so workers may mark concurrently.
+//
+// heights are not stored: the height of a type (the number of powers
+// from 1 to the order of the type for which the type raised to the
+// power equals the type itself) is the totient of the order, and is
+// only needed for the unmarked types when summing the width.
+type markTable struct {
+	bits []uint64
+	size int
+}
 
-	height *big.Int  // the number of powers from 1 to the order
-	                 // of the type for which the type raised to
-	                 // the power equals the type itself.  equal
-	                 // to the totient of the order.
+func newMarkTable(size int) markTable {
+	return markTable{bits: make([]uint64, (size+63)/64), size: size}
 }
 
 func (m markTable) marked(index int) bool {
-	return m[index].marked
+	return atomic.LoadUint64(&m.bits[index/64])&(1<<uint(index%64)) != 0
 }
 
 func (m markTable) mark(index int) {
-	m[index].marked = true
+	word := &m.bits[index/64]
+	bit := uint64(1) << uint(index%64)
+	for {
+		old := atomic.LoadUint64(word)
+		if old&bit != 0 || atomic.CompareAndSwapUint64(word, old, old|bit) {
+			return
+		}
+	}
 }
 
 func (m markTable) reset() {
-	for i := 0; i < len(m); i++ {
-		m[i].marked = false
-		m[i].height = nil
+	for i := range m.bits {
+		atomic.StoreUint64(&m.bits[i], 0)
 	}
 }
 
 func (m markTable) numMarks() (marks int) {
-	for _, b := range m {
-		if b.marked {
-			marks++
-		}
+	for i := range m.bits {
+		marks += bits.OnesCount64(atomic.LoadUint64(&m.bits[i]))
 	}
 	return marks
 }
 
 func (m markTable) numUnmarked() (unmarked int) {
-	for _, b := range m {
-		if !b.marked {
-			unmarked++
-		}
+	return m.size - m.numMarks()
+}
+
+func (m markTable) sizeBytes() int {
+	return 8 * len(m.bits)
+}
+
+// NewExpanderV3 returns the expander of degree, which is at most
+// MaxPartitionStoreDegree.
+func NewExpanderV3(degree int) (*ExpanderV3, error) {
+	if err := checkDegree("ExpanderV3", degree, MaxPartitionStoreDegree); err != nil {
+		return nil, err
 	}
-	return unmarked
+	return &ExpanderV3{degree: degree, numWorkers: runtime.NumCPU(), observer: defaultObserver}, nil
 }
 
-// note: takes ownership of height ptr
-func (m markTable) setHeight(index int, height *big.Int) {
-	m[index].height = height
+func (exp *ExpanderV3) Degree() int {
+	return exp.degree
 }
 
-func (m markTable) height(index int) *big.Int {
-	return m[index].height
+// SetNumWorkers sets the number of workers used by Expand; k < 1
+// means one per cpu.  the result does not depend on it.
+func (exp *ExpanderV3) SetNumWorkers(k int) {
+	if k < 1 {
+		k = runtime.NumCPU()
+	}
+	exp.numWorkers = k
 }
 
-func NewExpanderV3(degree int) *ExpanderV3 {
-	return &ExpanderV3{degree: degree}
+func (exp *ExpanderV3) NumWorkers() int {
+	return exp.numWorkers
 }
 
-func (exp *ExpanderV3) Degree() int {
-	return exp.degree
+// SetObserver makes the expander report to o rather than log; nil
+// restores logging.
+func (exp *ExpanderV3) SetObserver(o Observer) {
+	exp.observer = observerOrDefault(o)
+}
+
+// SetPartitionFile makes the expander map its partitions from a file
+// written by WritePartitionFile rather than generate them.
+func (exp *ExpanderV3) SetPartitionFile(path string) {
+	exp.partitionFile = path
+}
+
+// SetMemoryBudget bounds the bytes the expander may hold for
+// partitions and marks; 0 means no bound.  partitions mapped from a
+// file do not count against it.  a degree over budget is an error of
+// Expand before anything is allocated, rather than running out of
+// memory later.
+func (exp *ExpanderV3) SetMemoryBudget(bytes int64) {
+	exp.memoryBudget = bytes
+}
+
+// SetCheckpoint makes the expander write a checkpoint to path every
+// interval while it expands or sums the width, and when it is
+// interrupted.  see checkpoint.go.
+func (exp *ExpanderV3) SetCheckpoint(path string, interval time.Duration) {
+	exp.checkpointPath = path
+	exp.checkpointInterval = interval
+}
+
+// SetInterrupt gives a channel whose closing stops the expander after
+// the chunks in hand.  it then writes its checkpoint, if one is set,
+// and Expand or WidthContext returns ErrInterrupted.
+func (exp *ExpanderV3) SetInterrupt(ch <-chan struct{}) {
+	exp.interrupt = ch
+}
+
+// ResumeFrom makes the expander continue from the checkpoint at path
+// rather than start over.  the result is the same as an unbroken run.
+func (exp *ExpanderV3) ResumeFrom(path string) {
+	exp.resumePath = path
+}
+
+// ExpandContext is Expand, stopping the workers after the chunks in
+// hand once ctx is done.  it then writes the checkpoint, if one is set,
+// and returns the error of ctx; the marks so far are kept, so a later
+// Expand carries on with the same result.
+func (exp *ExpanderV3) ExpandContext(ctx context.Context) error {
+	defer exp.bindContext(ctx)()
+	return canceled(ctx, exp.Expand())
+}
+
+// WidthContext is Width, stopping as ExpandContext does, and returning
+// the errors that Width panics with.
+func (exp *ExpanderV3) WidthContext(ctx context.Context) (*big.Int, error) {
+	defer exp.bindContext(ctx)()
+	if exp.width == nil {
+		if err := exp.calculateWidth(); err != nil {
+			return nil, canceled(ctx, err)
+		}
+	}
+	return exp.width, nil
+}
+
+// bindContext adds ctx to the interrupt channel until the returned
+// function is called.
+func (exp *ExpanderV3) bindContext(ctx context.Context) (release func()) {
+	saved := exp.interrupt
+	ch, stop := mergeDone(saved, ctx.Done())
+	exp.interrupt = ch
+	return func() {
+		stop()
+		exp.interrupt = saved
+	}
 }
 
+// NumMaximalTypes expands if need be, and panics with the error of
+// Expand, or ErrSharded.
 func (exp *ExpanderV3) NumMaximalTypes() int {
-	exp.Expand()
+	if err := exp.checkUnsharded(); err != nil {
+		panic(err)
+	}
+	if err := exp.Expand(); err != nil {
+		panic(err)
+	}
 	return exp.markTable.numUnmarked()
 }
 
-func (exp *ExpanderV3) String() (s string) {
-	return exp.dumpPartitionsAndMarks()
+func (exp *ExpanderV3) String() string {
+	return renderString(exp.WriteTo)
+}
+
+// WriteTo writes the partitions as types, the marked ones struck out
+// with a leading "/".
+func (exp *ExpanderV3) WriteTo(w io.Writer) (int64, error) {
+	return exp.dumpPartitionsAndMarks(w)
 }
 
+// Width expands and sums the width if need be, and panics with the
+// error of Expand, or ErrSharded; WidthContext returns them.
 func (exp *ExpanderV3) Width() *big.Int {
 	if exp.width != nil {
 		return exp.width
 	}
-	exp.calculateWidth()
+	if err := exp.calculateWidth(); err != nil {
+		panic(err)
+	}
 	return exp.width
 }
 
@@ -121,76 +256,292 @@ func (exp *ExpanderV3) Order() *big.Int {
 	return Factorial(exp.degree)
 }
 
-func (exp *ExpanderV3) Expand() {
+// Extend returns the expander of the next degree, built from this one.
+//
+// in ruleAsc order the partitions of n+1 begin with 1 followed by each
+// partition of n, in the order of n, and the rest have no 1s.  a type
+// 1+s is a proper power of some type u exactly when s is a proper
+// power at degree n (u = 1+v with v^k = s), or u has no fixed points
+// and some of its cycles split into the fixed point; and a type with
+// no fixed points can only be a power of a type with none.  so the
+// marks of n carry over bit for bit to the first p(n) indices, and
+// only the partitions without 1s need to be expanded.
+func (exp *ExpanderV3) Extend() (*ExpanderV3, error) {
+	if err := exp.Expand(); err != nil {
+		return nil, err
+	}
+	next, err := NewExpanderV3(exp.degree + 1)
+	if err != nil {
+		return nil, err
+	}
+	next.numWorkers = exp.numWorkers
+	next.interrupt = exp.interrupt
+	next.observer = exp.observer
+	next.observer.Printf("extending partitions; n=%d", next.degree)
+	t0 := beginPhase(next.observer, PhaseGeneratingPartitions, next.degree)
+	if next.partitions, err = exp.partitions.Extend(); err != nil {
+		return nil, err
+	}
+	next.TimeToGeneratePartitions = endPhase(next.observer, PhaseGeneratingPartitions, next.degree,
+		next.partitions.Len(), t0)
+	next.reportTimes()
+	next.markTable = newMarkTable(next.partitions.Len())
+	for i := range exp.markTable.bits {
+		next.markTable.bits[i] = atomic.LoadUint64(&exp.markTable.bits[i])
+	}
+	next.firstNew = exp.partitions.Len()
+	return next, nil
+}
+
+// Expand marks the proper powers.  the panic of a worker is returned
+// as a *WorkerPanicError, and an interrupt as ErrInterrupted, once the
+// checkpoint is written.
+func (exp *ExpanderV3) Expand() error {
 	if exp.expanded {
-		return
+		return nil
+	}
+	if err := exp.ensureSortedPartitions(); err != nil {
+		return err
 	}
-	exp.ensureSortedPartitions()
 	exp.ensureMarkTable()
-	log.Printf("begin expansion")
-	t0 := time.Now()
+	if err := exp.resume(); err != nil {
+		return err
+	}
+	if w, ok := exp.observer.(expanderWatcher); ok {
+		w.watchMarks(exp.degree, exp.markTable)
+	}
+	if exp.expanded {
+		return nil
+	}
+	t0 := beginPhase(exp.observer, PhaseExpanding, exp.degree)
+	exp.observer.Printf("expanding; n=%d markbytes=%d", exp.degree, exp.markTable.sizeBytes())
 	exp.spawnWorkers()
-	exp.distributeWork()
-	exp.closeWorkers()
-	exp.TimeToExpand = time.Since(t0)
-	log.Printf("expansion complete; n=%d exptime=%v", exp.degree, int(exp.TimeToExpand.Seconds()))
+	exp.distributeWork(exp.expansionBegin(), exp.expansionEnd())
+	stop := exp.startCheckpoints(checkpointExpanding, exp.progress)
+	err := exp.closeWorkers()
+	stop()
+	if err != nil {
+		return err
+	}
+	if err := exp.stopIfInterrupted(checkpointExpanding, exp.progress); err != nil {
+		return err
+	}
+	exp.progress = nil
+	exp.TimeToExpand = endPhase(exp.observer, PhaseExpanding, exp.degree,
+		exp.expansionEnd()-exp.expansionBegin(), t0)
 	exp.expanded = true
+	exp.reportTimes()
+	if exp.checkpointPath != "" {
+		// keep the marks, should the width phase be lost
+		size := exp.partitions.Len()
+		if err := exp.writeCheckpoint(checkpointSummingWidth, newChunkProgress(0, size, bigZero)); err != nil {
+			exp.observer.Printf("checkpoint failed; n=%d err=%v", exp.degree, err)
+		}
+	}
+	return nil
 }
 
-func (exp *ExpanderV3) calculateWidth() {
+// calculateWidth sums the widths of the unmarked types.  the
+// partitions are split into chunks as for Expand, each chunk has its
+// own partial sum, and the sums are added in as the frontier passes
+// them, so a checkpoint holds the width below the frontier.
+func (exp *ExpanderV3) calculateWidth() error {
 	t0 := time.Now()
-	exp.Expand()
-	// future: could parallelize this by fanning out partitions to workers again
-	log.Printf("calculating width; n=%d", exp.degree)
-	t1 := time.Now()
-	width := big.NewInt(0)
-	var t CycleType = make([]int, exp.degree)
-	for i, p := range exp.sortedPartitions {
-		if exp.marked(i) {
-			continue
-		}
-		p.CycleType(t) // xxx optimization? avoid conversion?
-		z := exp.TypeWidth(i, p, t)
-		width.Add(width, z)
-		//log.Printf("t=%v z=%v", &t, z)
+	if err := exp.checkUnsharded(); err != nil {
+		return err
+	}
+	if err := exp.Expand(); err != nil {
+		return err
+	}
+	exp.ensureTypeTables()
+	k := exp.numWorkers
+	size := exp.partitions.Len()
+	begin, partial := 0, bigZero
+	if exp.resumed != nil {
+		begin, partial = exp.resumed.frontier, exp.resumed.width
+		exp.resumed = nil
+	}
+	t1 := beginPhase(exp.observer, PhaseSummingWidth, exp.degree)
+	exp.observer.Printf("summing width; n=%d workers=%d first=%d", exp.degree, k, begin)
+	queues := newWorkQueues(begin, size, workChunkSize(size-begin, k), k)
+	progress := newChunkProgress(begin, size, partial)
+	progress.observe = progressReporter(exp.observer, PhaseSummingWidth, exp.degree, size-begin)
+	stop := exp.startCheckpoints(checkpointSummingWidth, progress)
+	exp.panics = &workerPanics{}
+	var wg sync.WaitGroup
+	for i := 0; i < k; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer exp.panics.catch(i)
+			exp.sumWidth(queues, i, progress)
+		}(i)
 	}
+	wg.Wait()
+	stop()
+	if err := exp.panics.result(); err != nil {
+		return err
+	}
+	if err := exp.stopIfInterrupted(checkpointSummingWidth, progress); err != nil {
+		return err
+	}
+	_, width := progress.state()
 	exp.width = width
-	exp.TimeToSumWidth = time.Since(t1)
+	if err := exp.RemoveCheckpoint(); err != nil {
+		exp.observer.Printf("removing checkpoint failed; n=%d err=%v", exp.degree, err)
+	}
+	exp.TimeToSumWidth = endPhase(exp.observer, PhaseSummingWidth, exp.degree, size-begin, t1)
 	exp.TimeTotalToComputeWidth = time.Since(t0)
-	log.Printf("done calculating width; n=%d width=%v swtime=%v wtime=%v", exp.degree, width,
-		int(exp.TimeToSumWidth.Seconds()), int(exp.TimeTotalToComputeWidth.Seconds()))
+	exp.reportTimes()
+	exp.observer.Printf("width; n=%d width=%v wtime=%v", exp.degree, width,
+		int(exp.TimeTotalToComputeWidth.Seconds()))
+	return nil
+}
+
+// sumWidth sums the widths of the chunks of the queues, one partial sum
+// per chunk, so that progress can pass them in order.
+func (exp *ExpanderV3) sumWidth(queues []*workQueue, self int, progress *chunkProgress) {
+	z := big.NewInt(0)
+	scratch := exp.types.newScratch()
+	var t CycleType = make([]int, exp.degree)
+	drainWorkQueues(queues, self, func(c workChunk) {
+		if interrupted(exp.interrupt) || exp.panics.failed() {
+			return
+		}
+		sum := big.NewInt(0)
+		for i := c.begin; i < c.end; i++ {
+			if exp.marked(i) {
+				continue
+			}
+			exp.partitions.At(i).CycleType(t)
+			exp.types.typeWidth(t, scratch, z)
+			sum.Add(sum, z)
+		}
+		progress.complete(self, c, sum)
+		if exp.onChunk != nil {
+			exp.onChunk()
+		}
+	})
+}
+
+// reportTimes hands the TimeTo* durations to an observer that keeps
+// them; see Metrics.
+func (exp *ExpanderV3) reportTimes() {
+	w, ok := exp.observer.(expanderWatcher)
+	if !ok {
+		return
+	}
+	w.expanderTimes(exp.degree, map[string]time.Duration{
+		"TimeToGeneratePartitions": exp.TimeToGeneratePartitions,
+		"TimeToDistributeWork": exp.TimeToDistributeWork,
+		"TimeToWaitForWorkers": exp.TimeToWaitForWorkers,
+		"TimeToExpand": exp.TimeToExpand,
+		"TimeToSumWidth": exp.TimeToSumWidth,
+		"TimeTotalToComputeWidth": exp.TimeTotalToComputeWidth,
+		"TimeWorkersIdle": exp.TimeWorkersIdle,
+	})
 }
 
 func (exp *ExpanderV3) TypeWidth(i int, p Partition, t CycleType) *big.Int {
 	if exp.marked(i) {
 		return bigZero
 	}
-	z := t.CardinalityOfConjugacyClass()
-	//log.Printf("xxx i=%d p=%v z=%v h=%v", i, p, z, exp.height(i))
-	z.Div(z, exp.height(i))
+	exp.ensureTypeTables()
+	z := big.NewInt(0)
+	exp.types.typeWidth(t, exp.types.newScratch(), z)
 	return z
 }
 
-func (exp *ExpanderV3) ensureSortedPartitions() {
-	if len(exp.sortedPartitions) == 0 {
-		exp.generateSortedPartitions()
+func (exp *ExpanderV3) ensureTypeTables() {
+	if exp.types == nil {
+		exp.types = newTypeTables(exp.degree)
 	}
 }
 
-func (exp *ExpanderV3) generateSortedPartitions() {
-	log.Printf("generating partitions; n=%d", exp.degree)
-	t0 := time.Now()
-	exp.sortedPartitions = AllPartitions(exp.degree)
-	exp.TimeToGeneratePartitions = time.Since(t0)
-	log.Printf("done generating partitions; n=%d parts=%d parttime=%v",
+// Partitions returns the store of all partitions of the degree in
+// ruleAsc order; the indices of the mark table refer to it.  it panics
+// if they cannot be generated or mapped.
+func (exp *ExpanderV3) Partitions() *PartitionStore {
+	if err := exp.ensureSortedPartitions(); err != nil {
+		panic(err)
+	}
+	return exp.partitions
+}
+
+// Close releases the mapping of the partitions, if they were mapped
+// from the file of SetPartitionFile.  the expander must not be used
+// afterwards, except for the results it has already computed.
+func (exp *ExpanderV3) Close() error {
+	if exp.partitions == nil {
+		return nil
+	}
+	err := exp.partitions.Close()
+	exp.partitions = nil
+	return err
+}
+
+func (exp *ExpanderV3) ensureSortedPartitions() error {
+	if exp.partitions == nil {
+		return exp.generateSortedPartitions()
+	}
+	return nil
+}
+
+func (exp *ExpanderV3) generateSortedPartitions() error {
+	if err := exp.checkMemoryBudget(); err != nil {
+		return err
+	}
+	t0 := beginPhase(exp.observer, PhaseGeneratingPartitions, exp.degree)
+	if exp.partitionFile != "" {
+		exp.observer.Printf("mapping partitions; n=%d file=%s", exp.degree, exp.partitionFile)
+		store, err := OpenPartitionFile(exp.partitionFile, exp.degree)
+		if err != nil {
+			return err
+		}
+		exp.partitions = store
+	} else {
+		store, err := NewPartitionStoreWithWorkers(exp.degree, exp.numWorkers)
+		if err != nil {
+			return err
+		}
+		exp.partitions = store
+	}
+	exp.TimeToGeneratePartitions = endPhase(exp.observer, PhaseGeneratingPartitions, exp.degree,
+		exp.partitions.Len(), t0)
+	exp.reportTimes()
+	exp.observer.Printf("partitions; n=%d parts=%d bytes=%d",
 		exp.degree,
-		len(exp.sortedPartitions),
-		int(exp.TimeToGeneratePartitions.Seconds()))
+		exp.partitions.Len(),
+		exp.partitions.SizeBytes())
+	return nil
+}
+
+func (exp *ExpanderV3) checkMemoryBudget() error {
+	if exp.memoryBudget <= 0 {
+		return nil
+	}
+	plan, err := NewResourcePlan("ExpanderV3", exp.degree)
+	if err != nil {
+		return err
+	}
+	need := new(big.Int).Set(plan.MarkBytes)
+	if exp.partitionFile == "" {
+		need.Add(need, plan.PartitionBytes)
+	}
+	if need.Cmp(big.NewInt(exp.memoryBudget)) > 0 {
+		hint := ""
+		if exp.partitionFile == "" {
+			hint = "; write a partition file with gen-partition-file and map it"
+		}
+		return fmt.Errorf("expander over memory budget; n=%d need=%v budget=%d%s",
+			exp.degree, need, exp.memoryBudget, hint)
+	}
+	return nil
 }
 
 func (exp *ExpanderV3) ensureMarkTable() {
-	if len(exp.markTable) == 0 {
-		exp.markTable = make([]typeMark, len(exp.sortedPartitions))
+	if exp.markTable.bits == nil {
+		exp.markTable = newMarkTable(exp.partitions.Len())
 	}
 }
 
@@ -199,110 +550,166 @@ func (exp *ExpanderV3) resetMarkTable() {
 }
 
 func (exp *ExpanderV3) spawnWorkers() {
-	for i := 0; i < runtime.NumCPU(); i++ {
-		exp.wg.Add(1)
-		worker := exp.newWorker(i, exp.degree)
-		exp.workers = append(exp.workers, worker)
+	exp.workers = nil
+	for i := 0; i < exp.numWorkers; i++ {
+		exp.workers = append(exp.workers, exp.newWorker(i, exp.degree))
 	}
-	log.Printf("spawned %d workers", len(exp.workers))
+	exp.observer.Printf("spawned %d workers", len(exp.workers))
 }
 
-func (exp *ExpanderV3) distributeWork() {
-	var i int
-	var p Partition
+// distributeWork splits the partitions of [begin, end) into chunks,
+// deals them to the workers' queues and starts the workers.  a worker whose own queue
+// runs dry steals chunks from the others, so partitions with many
+// divisors of the order do not leave the rest of the workers idle.
+func (exp *ExpanderV3) distributeWork(begin, end int) {
 	var v = len(exp.workers)
 	t0 := time.Now()
-	log.Printf("distributing to workers; workers=%d", v)
-	for i, p = range exp.sortedPartitions {
-		//log.Printf("i=%d p=%v work", i, p)
-		exp.workers[i % v].queue <- expanderV3WorkerWork{p, i}
+	chunkSize := workChunkSize(end-begin, v)
+	exp.queues = newWorkQueues(begin, end, chunkSize, v)
+	exp.panics = &workerPanics{}
+	exp.progress = newChunkProgress(begin, end, bigZero)
+	exp.progress.observe = progressReporter(exp.observer, PhaseExpanding, exp.degree, end-begin)
+	exp.observer.Printf("distributing to workers; workers=%d chunksize=%d first=%d end=%d", v, chunkSize, begin, end)
+	for _, w := range exp.workers {
+		w.queues = exp.queues
+		w.progress = exp.progress
+		w.panics = exp.panics
+		exp.wg.Add(1)
+		go w.main(t0)
 	}
 	exp.TimeToDistributeWork = time.Since(t0)
-	log.Printf("done distributing to workers; disttime=%v", int(exp.TimeToDistributeWork.Seconds()))
+	exp.observer.Printf("done distributing to workers; disttime=%v", int(exp.TimeToDistributeWork.Seconds()))
 }
 
-func (exp *ExpanderV3) closeWorkers() {
-	for _, w := range exp.workers {
-		close(w.queue)
-	}
+// closeWorkers waits on the workers, and returns the first panic of
+// one.
+func (exp *ExpanderV3) closeWorkers() error {
 	t0 := time.Now()
-	log.Printf("waiting on workers")
+	exp.observer.Printf("waiting on workers")
 	exp.wg.Wait()
 	exp.TimeToWaitForWorkers = time.Since(t0)
-	log.Printf("done waiting for workers; wtime=%v", int(exp.TimeToWaitForWorkers.Seconds()))
+	var last time.Duration
+	for _, w := range exp.workers {
+		if w.result.timeToFinish > last {
+			last = w.result.timeToFinish
+		}
+	}
+	exp.Steals = 0
+	exp.TimeWorkersIdle = 0
+	for _, w := range exp.workers {
+		exp.Steals += w.result.stealCount
+		exp.TimeWorkersIdle += last - w.result.timeToFinish
+	}
+	exp.observer.Printf("done waiting for workers; wtime=%v steals=%d idle=%v", int(exp.TimeToWaitForWorkers.Seconds()),
+		exp.Steals, exp.TimeWorkersIdle)
 	for i, w := range exp.workers {
-		log.Printf("worker %d result: transactions=%d tps=%d", i,
-			w.result.transactionCount, int(w.result.transactionRate))
+		exp.observer.Worker(WorkerEvent{
+			Phase: PhaseExpanding,
+			Degree: exp.degree,
+			Worker: i,
+			Transactions: w.result.transactionCount,
+			Rate: w.result.transactionRate,
+			Chunks: w.result.chunkCount,
+			Steals: w.result.stealCount,
+			Finished: w.result.timeToFinish,
+		})
 	}
+	exp.queues = nil
+	return exp.panics.result()
 }
 
-func (exp *ExpanderV3) dumpPartitionsAndMarks() (s string) {
-	s = "types:\n"
-	for i, p := range exp.sortedPartitions {
+func (exp *ExpanderV3) dumpPartitionsAndMarks(w io.Writer) (int64, error) {
+	r := newRenderer(w)
+	r.print("types:\n")
+	var t CycleType = make([]int, exp.degree)
+	for i := 0; i < exp.partitions.Len(); i++ {
 		if exp.markTable.marked(i) {
-			s += "/"
+			r.print("/")
 		}
-		//s += fmt.Sprintf("%d: %v\n", i + 1, p.StringWithoutOneCycles())
-		t := p.CycleTypeOld()
-		s += fmt.Sprintf("%d: %v\n", i + 1, t.StringWithCarets())
+		//r.printf("%d: %v\n", i + 1, p.StringWithoutOneCycles())
+		exp.partitions.At(i).CycleType(t)
+		r.int(i + 1)
+		r.print(": ")
+		r.print(t.StringWithCarets())
+		r.print("\n")
 	}
-	return s
+	return r.done()
 }
 
 type expanderV3Worker struct {
 	index int
 	degree int
-	queue chan expanderV3WorkerWork
+	queues []*workQueue
+	progress *chunkProgress
+	interrupt <-chan struct{}
+	panics *workerPanics
+	onChunk func()
 	markTable
-	sortedPartitions SortablePartitions
+	partitions *PartitionStore
 	wg *sync.WaitGroup
 	result workerResult
+	ranker *PartitionRanker
 	ta, tb CycleType
-	q Partition
-	qbuf []int
-}
-
-type expanderV3WorkerWork struct {
-	p Partition
-	index int // index in the sortedPartitions (ruleAsc order)
+	pbuf []int
 }
 
 type workerResult struct {
 	transactionCount int
 	transactionRate float64
+	chunkCount int
+	stealCount int
+	timeToFinish time.Duration // since the work was distributed
 }
 
 func (exp *ExpanderV3) newWorker(index, degree int) *expanderV3Worker {
 	worker := &expanderV3Worker{
 		index: index,
 		degree: degree,
-		queue: make(chan expanderV3WorkerWork, 100),
 		markTable: exp.markTable,
-		sortedPartitions: exp.sortedPartitions,
+		partitions: exp.partitions,
 		wg: &exp.wg,
+		interrupt: exp.interrupt,
+		onChunk: exp.onChunk,
+		ranker: RankerFor(degree),
 		ta: make([]int, degree),
 		tb: make([]int, degree),
-		qbuf: make([]int, degree)}
-	go worker.main()
+		pbuf: make([]int, degree)}
 	return worker
 }
 
-func (worker *expanderV3Worker) main() {
+func (worker *expanderV3Worker) main(distributed time.Time) {
 	defer worker.wg.Done()
+	defer worker.panics.catch(worker.index)
 	t0 := time.Now()
-	var i int
-	for work := range worker.queue {
-		//log.Printf("worker %d i=%d p=%v", worker.index, work.index, work.p)
-		worker.processPartition(work.index, work.p)
-		worker.result.transactionCount++
-		i++
-	}
+	worker.result.stealCount = drainWorkQueues(worker.queues, worker.index, worker.processChunk)
+	worker.result.timeToFinish = time.Since(distributed)
 	seconds := time.Since(t0).Seconds()
 	if seconds > 0 {
 		worker.result.transactionRate = float64(worker.result.transactionCount) / float64(seconds)
 	}
 }
 
+// processChunk skips the chunk once the expander is interrupted,
+// leaving it for the resumed run, or once a worker has panicked.
+func (worker *expanderV3Worker) processChunk(c workChunk) {
+	if interrupted(worker.interrupt) || worker.panics.failed() {
+		return
+	}
+	for i := c.begin; i < c.end; i++ {
+		p := worker.partitions.PartitionAt(i, worker.pbuf)
+		//log.Printf("worker %d i=%d p=%v", worker.index, i, p)
+		worker.processPartition(i, p)
+	}
+	worker.result.transactionCount += c.len()
+	worker.result.chunkCount++
+	worker.progress.complete(worker.index, c, nil)
+	if worker.onChunk != nil {
+		worker.onChunk()
+	}
+}
+
+// the type of t^k depends only on gcd(k, order), so it suffices to
+// visit one exponent per divisor of the order.
 func (worker *expanderV3Worker) processPartition(index int, p Partition) {
 	debug := false
 	s := ""
@@ -313,39 +720,19 @@ func (worker *expanderV3Worker) processPartition(index int, p Partition) {
 		s = fmt.Sprintf("%d", index + 1)
 	}
 	p.CycleType(worker.ta)
-	k := 2 // xxx may need to be a big int at some point...
-	height := big.NewInt(1)
-	if worker.ta.IsIdentity() {
-		goto done
-	}
-	for {
-		worker.ta.Power(k, worker.tb)
-		if worker.ta.Equal(&worker.tb) {
-			height.Add(height, bigOne)
-		} else {
-			worker.tb.Partition(&worker.q, worker.qbuf)
-			z := worker.partitionIndex(worker.q)
-			worker.markTable.mark(z)
-			if debug {
-				s += fmt.Sprintf(" %d", z + 1)
-			}
+	order := worker.ta.OrderFactorization()
+	for _, k := range order.Divisors() {
+		if k.IsOne() {
+			continue
 		}
-		if worker.tb.IsIdentity() {
-			break
+		worker.ta.PowerFactorization(k, worker.tb)
+		z := worker.ranker.RankCycleType(worker.tb)
+		worker.markTable.mark(z)
+		if debug {
+			s += fmt.Sprintf(" %d", z + 1)
 		}
-		k++
 	}
-done:
-	worker.markTable.setHeight(index, height)
 	if debug {
 		fmt.Print(s + "\n")
 	}
 }
-
-func (worker *expanderV3Worker) partitionIndex(p Partition) int {
-	index, found := worker.sortedPartitions.Search(p)
-	if !found {
-		panic(fmt.Errorf("failed to find partition=%v degree=%d", p, worker.degree))
-	}
-	return index
-}
@@ -3,12 +3,16 @@
 package den
 
 import (
+	"sync"
 	"testing"
 )
 
 func TestWorkerProcessPartition(t *testing.T) {
 	d := 10
-	exp := NewExpanderV3(d)
+	exp, err := NewExpanderV3(d)
+	if err != nil {
+		t.Fatal(err)
+	}
 	exp.ensureSortedPartitions()
 	exp.ensureMarkTable()
 	worker := exp.newWorker(0, exp.degree)
@@ -70,3 +74,143 @@ func TestWorkerProcessPartition(t *testing.T) {
 	}
 	
 }
+
+func TestWidthV3KnownValues(t *testing.T) {
+	// seq/WidthV3.txt
+	knownWidths := []string{
+		"1", "1", "4", "13", "31", "246", "1296", "10774", "83238", "788820",
+		"6835170", "81364944", "848378532", "11423650616", "156289508025",
+		"2380629720720", "33284133330760", "605934954285120", "9708364832948820",
+		"190330953679235040", "3715069138923234960", "77101583995105472880",
+		"1506549946554254503440", "37085926496811294533760",
+		"813989318776589220602400", "20286724694924822693488800",
+		"503710829808452894892841200", "13887195057050218869166488000",
+		"348272721955775727439932808800", "11013343418113167554927377927200"}
+	maxDegree := len(knownWidths)
+	if testing.Short() {
+		maxDegree = 20
+	}
+	for d := 1; d <= maxDegree; d++ {
+		exp, err := NewExpanderV3(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		width := exp.Width().String()
+		if width != knownWidths[d-1] {
+			t.Errorf("width mismatch; d=%d expected=%s got=%s", d, knownWidths[d-1], width)
+		}
+	}
+}
+
+func TestWidthV3IndependentOfWorkers(t *testing.T) {
+	maxDegree := 30
+	if testing.Short() {
+		maxDegree = 18
+	}
+	for d := 1; d <= maxDegree; d++ {
+		var expected string
+		for _, k := range []int{1, 2, 3, 7} {
+			exp, err := NewExpanderV3(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			exp.SetNumWorkers(k)
+			width := exp.Width().String()
+			if k == 1 {
+				expected = width
+			} else if width != expected {
+				t.Errorf("width depends on workers; d=%d workers=%d expected=%s got=%s", d, k, expected, width)
+			}
+			steals := 0
+			for _, w := range exp.workers {
+				steals += w.result.stealCount
+			}
+			if exp.Steals != steals || exp.TimeWorkersIdle < 0 {
+				t.Errorf("scheduling; d=%d workers=%d expected steals=%d got steals=%d idle=%v", d, k,
+					steals, exp.Steals, exp.TimeWorkersIdle)
+			}
+			if k == 1 && (exp.Steals != 0 || exp.TimeWorkersIdle != 0) {
+				t.Errorf("a lone worker stole or idled; d=%d steals=%d idle=%v", d, exp.Steals, exp.TimeWorkersIdle)
+			}
+		}
+	}
+}
+
+func TestMarkTableConcurrentMark(t *testing.T) {
+	size := 10000
+	m := newMarkTable(size)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			// overlapping strides, so that workers contend for words
+			for i := w % 3; i < size; i += 3 + w%2 {
+				m.mark(i)
+			}
+		}(w)
+	}
+	wg.Wait()
+	expected := 0
+	for i := 0; i < size; i++ {
+		set := false
+		for w := 0; w < 8; w++ {
+			if i >= w%3 && (i-w%3)%(3+w%2) == 0 {
+				set = true
+			}
+		}
+		if set {
+			expected++
+		}
+		if m.marked(i) != set {
+			t.Errorf("i=%d expected marked=%v", i, set)
+		}
+	}
+	if m.numMarks() != expected || m.numUnmarked() != size-expected {
+		t.Errorf("expected marks=%d got=%d unmarked=%d", expected, m.numMarks(), m.numUnmarked())
+	}
+	m.reset()
+	if m.numMarks() != 0 {
+		t.Errorf("expected no marks after reset")
+	}
+}
+
+func TestExpanderV3Extend(t *testing.T) {
+	maxDegree := 35
+	if testing.Short() {
+		maxDegree = 25
+	}
+	exp, err := NewExpanderV3(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for d := 2; d <= maxDegree; d++ {
+		next, err := exp.Extend()
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp = next
+		fresh, err := NewExpanderV3(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exp.Degree() != d {
+			t.Fatalf("degree; expected=%d got=%d", d, exp.Degree())
+		}
+		if exp.Width().Cmp(fresh.Width()) != 0 {
+			t.Errorf("width; d=%d expected=%v got=%v", d, fresh.Width(), exp.Width())
+		}
+		if exp.NumMaximalTypes() != fresh.NumMaximalTypes() {
+			t.Errorf("maximal types; d=%d expected=%d got=%d", d, fresh.NumMaximalTypes(), exp.NumMaximalTypes())
+		}
+		for i := 0; i < fresh.partitions.Len(); i++ {
+			if !exp.partitions.At(i).Unpack(make([]int, d)).Equal(fresh.partitions.At(i).Unpack(make([]int, d))) {
+				t.Errorf("partition; d=%d i=%d expected=%v got=%v", d, i, fresh.partitions.At(i), exp.partitions.At(i))
+				break
+			}
+			if exp.marked(i) != fresh.marked(i) {
+				t.Errorf("mark; d=%d i=%d expected=%v", d, i, fresh.marked(i))
+			}
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"log"
+	"math/big"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ExpanderV4 computes the width without a mark table.  it walks the
+// types of S_n depth first by multiplicity, from the longest cycle
+// length down to 1-cycles, and decides maximality of each type locally
+// (see maximal.go).  subtrees that can no longer produce a maximal
+// type are pruned, and the width contribution
+//
+//   |class of t| / phi(order of t)
+//
+// of each maximal type is accumulated as it is found.  memory is O(n)
+// per worker plus O(n log n) shared tables, so degrees well past 100
+// are limited only by time.
+type ExpanderV4 struct {
+	degree int
+	expanded bool
+	width *big.Int
+	numMaximalTypes int
+	numWorkers int
+	tables *typeTables
+
+	TimeToExpand time.Duration
+	TimeTotalToComputeWidth time.Duration
+}
+
+func NewExpanderV4(degree int) (*ExpanderV4, error) {
+	if err := checkDegree("ExpanderV4", degree, 0); err != nil {
+		return nil, err
+	}
+	return &ExpanderV4{degree: degree, numWorkers: runtime.NumCPU()}, nil
+}
+
+func (exp *ExpanderV4) Degree() int {
+	return exp.degree
+}
+
+// SetNumWorkers is as for ExpanderV3.
+func (exp *ExpanderV4) SetNumWorkers(k int) {
+	if k < 1 {
+		k = runtime.NumCPU()
+	}
+	exp.numWorkers = k
+}
+
+// NumMaximalTypes and Width panic with the error of Expand.
+func (exp *ExpanderV4) NumMaximalTypes() int {
+	if err := exp.Expand(); err != nil {
+		panic(err)
+	}
+	return exp.numMaximalTypes
+}
+
+func (exp *ExpanderV4) Width() *big.Int {
+	if err := exp.Expand(); err != nil {
+		panic(err)
+	}
+	return exp.width
+}
+
+func (exp *ExpanderV4) Density() *big.Rat {
+	d := big.NewRat(1, 1)
+	d.SetFrac(exp.Width(), exp.Order())
+	return d
+}
+
+func (exp *ExpanderV4) Order() *big.Int {
+	return Factorial(exp.degree)
+}
+
+// the walk is split into tasks by the longest cycle length L and its
+// multiplicity; workers pull tasks until none are left.
+type expanderV4Task struct {
+	length int
+	multiplicity int
+}
+
+// Expand walks the types; the panic of a walker is returned as a
+// *WorkerPanicError.
+func (exp *ExpanderV4) Expand() error {
+	if exp.expanded {
+		return nil
+	}
+	log.Printf("begin v4 expansion; n=%d workers=%d", exp.degree, exp.numWorkers)
+	t0 := time.Now()
+	exp.tables = newTypeTables(exp.degree)
+	tasks := make(chan expanderV4Task, 100)
+	walkers := make([]*expanderV4Walker, exp.numWorkers)
+	panics := &workerPanics{}
+	var wg sync.WaitGroup
+	for i := range walkers {
+		walkers[i] = newExpanderV4Walker(exp.tables)
+		wg.Add(1)
+		go func(i int, w *expanderV4Walker) {
+			defer wg.Done()
+			run := func(task expanderV4Task) {
+				defer panics.catch(i)
+				w.runTask(task)
+			}
+			// the tasks are drained after a panic, so that the
+			// sender does not block
+			for task := range tasks {
+				if !panics.failed() {
+					run(task)
+				}
+			}
+		}(i, walkers[i])
+	}
+	for L := exp.degree; L >= 2; L-- {
+		for m := 1; m*L <= exp.degree; m++ {
+			tasks <- expanderV4Task{L, m}
+		}
+	}
+	tasks <- expanderV4Task{1, exp.degree} // the identity
+	close(tasks)
+	wg.Wait()
+	if err := panics.result(); err != nil {
+		return err
+	}
+	exp.width = big.NewInt(0)
+	for _, w := range walkers {
+		exp.width.Add(exp.width, w.width)
+		exp.numMaximalTypes += w.numMaximalTypes
+	}
+	exp.TimeToExpand = time.Since(t0)
+	exp.TimeTotalToComputeWidth = exp.TimeToExpand
+	exp.expanded = true
+	log.Printf("v4 expansion complete; n=%d width=%v maximal=%d exptime=%v",
+		exp.degree, exp.width, exp.numMaximalTypes, int(exp.TimeToExpand.Seconds()))
+	return nil
+}
+
+type expanderV4Walker struct {
+	*typeTables
+	scratch *typeScratch
+	t CycleType
+	// unbalanced[p] counts the lengths l divisible by p with m_l not
+	// a multiple of p.  the type is a p-th power iff it is zero and
+	// some multiplicity reaches p.
+	unbalanced []int
+	centralizer []*big.Int // centralizer[l] is the partial product over lengths >= l
+	width *big.Int
+	numMaximalTypes int
+}
+
+func newExpanderV4Walker(tables *typeTables) *expanderV4Walker {
+	n := tables.degree
+	w := &expanderV4Walker{
+		typeTables: tables,
+		scratch: tables.newScratch(),
+		t: make(CycleType, n),
+		unbalanced: make([]int, n+1),
+		centralizer: make([]*big.Int, n+2),
+		width: big.NewInt(0),
+	}
+	for i := range w.centralizer {
+		w.centralizer[i] = big.NewInt(1)
+	}
+	return w
+}
+
+func (w *expanderV4Walker) runTask(task expanderV4Task) {
+	L := task.length
+	w.assign(L, task.multiplicity, bigOne) // longer lengths are absent
+	if L == 1 {
+		w.leaf(task.multiplicity)
+	} else {
+		w.walk(L-1, w.degree-L*task.multiplicity, task.multiplicity)
+	}
+	w.unassign(L)
+}
+
+// assign sets m_l = m, given the centralizer product over longer lengths.
+func (w *expanderV4Walker) assign(l, m int, centralizer *big.Int) {
+	w.t[l-1] = m
+	w.centralizer[l].Mul(centralizer, w.centralizerFactor[l][m])
+	for _, x := range Factor(l) {
+		if m%x.Prime != 0 {
+			w.unbalanced[x.Prime]++
+		}
+	}
+}
+
+func (w *expanderV4Walker) unassign(l int) {
+	m := w.t[l-1]
+	for _, x := range Factor(l) {
+		if m%x.Prime != 0 {
+			w.unbalanced[x.Prime]--
+		}
+	}
+	w.t[l-1] = 0
+}
+
+// walk assigns the multiplicities of lengths l down to 1, with
+// remaining points left to cover and maxMultiplicity the largest
+// multiplicity assigned so far.
+func (w *expanderV4Walker) walk(l, remaining, maxMultiplicity int) {
+	if remaining < l {
+		// lengths above remaining are necessarily absent
+		w.centralizer[remaining+1].Set(w.centralizer[l+1])
+		l = remaining
+	}
+	if l == 0 {
+		w.leaf(maxMultiplicity)
+		return
+	}
+	// a prime p > l can no longer be unbalanced, so if some
+	// multiplicity already reaches p the type is a p-th power.
+	for _, p := range w.primes {
+		if p > maxMultiplicity {
+			break
+		}
+		if p > l && w.unbalanced[p] == 0 {
+			return
+		}
+	}
+	if l == 1 {
+		w.assign(1, remaining, w.centralizer[2])
+		if remaining > maxMultiplicity {
+			maxMultiplicity = remaining
+		}
+		w.leaf(maxMultiplicity)
+		w.unassign(1)
+		return
+	}
+	for m := remaining / l; m >= 0; m-- {
+		w.assign(l, m, w.centralizer[l+1])
+		next := maxMultiplicity
+		if m > next {
+			next = m
+		}
+		w.walk(l-1, remaining-m*l, next)
+		w.unassign(l)
+	}
+}
+
+func (w *expanderV4Walker) leaf(maxMultiplicity int) {
+	for _, p := range w.primes {
+		if p > maxMultiplicity {
+			break
+		}
+		if w.unbalanced[p] == 0 {
+			return
+		}
+	}
+	w.numMaximalTypes++
+	z := w.scratch.z
+	w.height(w.t, w.scratch, z)
+	z.Mul(z, w.centralizer[1])
+	z.Quo(w.factorials[w.degree], z)
+	w.width.Add(w.width, z)
+}
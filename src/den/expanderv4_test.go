@@ -0,0 +1,33 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"testing"
+)
+
+func TestExpanderV4AgreesWithExpanderV3(t *testing.T) {
+	maxDegree := 35
+	if testing.Short() {
+		maxDegree = 25
+	}
+	for d := 1; d <= maxDegree; d++ {
+		v3, err := NewExpanderV3(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v4, err := NewExpanderV4(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v3.Width().Cmp(v4.Width()) != 0 {
+			t.Errorf("width mismatch; d=%d v3=%v v4=%v", d, v3.Width(), v4.Width())
+		}
+		if v3.NumMaximalTypes() != v4.NumMaximalTypes() {
+			t.Errorf("maximal types mismatch; d=%d v3=%d v4=%d", d, v3.NumMaximalTypes(), v4.NumMaximalTypes())
+		}
+		if v3.Density().Cmp(v4.Density()) != 0 {
+			t.Errorf("density mismatch; d=%d v3=%v v4=%v", d, v3.Density(), v4.Density())
+		}
+	}
+}
@@ -8,7 +8,7 @@ import (
 	"flag"
 	"fmt"
 	"image/png"
-	"io/ioutil"
+	"io"
 	"os"
 )
 
@@ -17,6 +17,7 @@ func exit_on_error(f func () error) {
 	var err error = f()
 
 	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
@@ -41,7 +42,9 @@ func main() {
 
 	flag.Parse()
 
-	var cpt *den.CPT = den.New_CPT(degree)
+	var cpt *den.CPT
+
+	exit_on_error(func() (err error) { cpt, err = den.New_CPT(degree); return })
 
 	exit_on_error(func() error { return cpt.Generate()})
 
@@ -76,9 +79,19 @@ func main() {
 
 	} else if dotOut != "" {
 
-		var dot string = cpt.Dot()
+		file, err := os.Create(dotOut)
+
+		if err != nil {
+			panic(err)
+		}
+
+		_, err = cpt.WriteDot(file)
+
+		if err != nil {
+			panic(err)
+		}
 
-		err := ioutil.WriteFile(dotOut, []byte(dot), 0644)
+		err = file.Close()
 
 		if err != nil {
 			panic(err)
@@ -86,13 +99,24 @@ func main() {
 
 	} else if latexCPT  {
 
-		fmt.Printf("%v", cpt.Latex())
+		write(cpt.WriteLatex)
 
 	} else if latexTypes {
 
 		fmt.Printf("%v", cpt.LatexTypes())
 
 	} else {
-		fmt.Printf("cpt=\n%v\n", cpt)
+		fmt.Print("cpt=\n")
+		write(cpt.WriteTo)
+		fmt.Print("\n")
+	}
+}
+
+func write(render func(io.Writer) (int64, error)) {
+
+	_, err := render(os.Stdout)
+
+	if err != nil {
+		panic(err)
 	}
 }
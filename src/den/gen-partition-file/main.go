@@ -0,0 +1,43 @@
+// Copyright 2018 Adam Marks
+
+package main
+
+import (
+	"den"
+	"flag"
+	"log"
+	"time"
+)
+
+// gen-partition-file writes the partitions of n to a file that
+// ExpanderV3 and the Abel table can map instead of holding them in
+// memory.  see partition_file.go for the format.
+func main() {
+	var degree int
+	var out string
+	var dir string
+	var verify bool
+
+	flag.IntVar(&degree, "n", 7, "degree of symmetric group")
+	flag.StringVar(&out, "o", "", "output file (default partitions-<n>.den in -dir)")
+	flag.StringVar(&dir, "dir", ".", "output directory")
+	flag.BoolVar(&verify, "verify", true, "reopen and check the file after writing")
+	flag.Parse()
+
+	if out == "" {
+		out = den.PartitionFilePath(dir, degree)
+	}
+	t0 := time.Now()
+	if err := den.WritePartitionFile(out, degree); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %s; n=%d time=%v", out, degree, time.Since(t0))
+	if verify {
+		store, err := den.OpenPartitionFile(out, degree)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("verified %s; partitions=%d bytes=%d", out, store.Len(), store.SizeBytes())
+		store.Close()
+	}
+}
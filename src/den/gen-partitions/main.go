@@ -24,12 +24,11 @@ func main() {
 		flag.Usage()
 		os.Exit(1)
 	}
-	var yield chan den.Partition = den.YieldAllPartitions(degree)
-
 	fmt.Printf("Lambda_%d = [\n", degree)
 
 	k := 0
-	for p := range yield {
+	for it := den.NewPartitionIterator(degree, nil); it.Next(); {
+		p := it.Partition()
 		k++
 		var s string
 		if matrixStyle {
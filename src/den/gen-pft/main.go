@@ -6,6 +6,8 @@ import (
 	"den"
 	"flag"
 	"fmt"
+	"log"
+	"os"
 )
 
 func main() {
@@ -18,11 +20,22 @@ func main() {
 
 	flag.Parse()
 
-	var P *den.PFT = den.NewPFT(degree, lambda)
+	P, err := den.NewPFT(degree, lambda)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	P.Generate()
+	if err := P.Generate(); err != nil {
+		log.Fatal(err)
+	}
 
-	P.Check()
+	if err := P.Check(); err != nil {
+		log.Fatal(err)
+	}
 
-	fmt.Printf("P=\n%v\n", P)
+	fmt.Print("P=\n")
+	if _, err := P.WriteTo(os.Stdout); err != nil {
+		panic(err)
+	}
+	fmt.Print("\n")
 }
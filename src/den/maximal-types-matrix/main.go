@@ -14,6 +14,7 @@ func exit_on_error(f func () error) {
 	var err error = f()
 
 	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
@@ -26,7 +27,9 @@ func main() {
 
 	flag.Parse()
 
-	var cpt *den.CPT = den.New_CPT(degree)
+	var cpt *den.CPT
+
+	exit_on_error(func() (err error) { cpt, err = den.New_CPT(degree); return })
 
 	exit_on_error(func() error { return cpt.Generate()})
 
@@ -34,6 +37,11 @@ func main() {
 
 	cpt.Width()
 
-	fmt.Print(cpt.MaximalTypesMatrixString())
+	_, err := cpt.WriteMaximalTypesMatrix(os.Stdout)
+
+	if err != nil {
+		panic(err)
+	}
+
 	fmt.Print("\n")
 }
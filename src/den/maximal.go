@@ -0,0 +1,141 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"fmt"
+)
+
+// local maximality.  a type t is maximal when the cyclic subgroups
+// generated by its elements are maximal among cyclic subgroups, i.e.
+// when t is not a proper power of any other type.
+//
+// if <u> is properly contained in some cyclic group, it is properly
+// contained in a minimal one <w>, and minimality forces the index to
+// be a prime p, so u is conjugate to (w^r)^p for some r coprime to the
+// order of w.  hence t is non-maximal iff t is the p-th power of some
+// type whose order is divisible by p, for some prime p.
+//
+// raising to the p-th power leaves a cycle of length l alone when p
+// does not divide l, and splits it into p cycles of length l/p when
+// it does.  reading this backwards, t is such a p-th power iff
+//
+//   (a) for every length l divisible by p, p divides m_l, since those
+//       cycles can only have come from splitting; and
+//   (b) some m_l >= p, so that at least one group of p equal cycles
+//       can be merged into a cycle of length p*l.
+//
+// both conditions depend only on the multiplicities of t, so no
+// partitions of n need to be enumerated.
+
+// MaximalityReport records how IsMaximal decided a type.
+type MaximalityReport struct {
+	Type *CycleType
+	Maximal bool
+	Prime int        // if not maximal, the prime of the witness
+	Root *CycleType  // if not maximal, a type whose Prime-th power is Type
+	Reasons []string // one line per prime considered
+}
+
+func (r *MaximalityReport) String() (s string) {
+	if r.Maximal {
+		s = fmt.Sprintf("%v is maximal", r.Type)
+	} else {
+		s = fmt.Sprintf("%v is not maximal: %v^%d = %v", r.Type, r.Root, r.Prime, r.Type)
+	}
+	for _, reason := range r.Reasons {
+		s += "\n  " + reason
+	}
+	return s
+}
+
+func (t *CycleType) IsMaximal() bool {
+	return t.ExplainMaximality().Maximal
+}
+
+// ExplainMaximality decides maximality from the multiplicities of t
+// and reports the prime by prime reasoning.  only primes up to the
+// largest multiplicity can satisfy (b).
+func (t *CycleType) ExplainMaximality() *MaximalityReport {
+	report := &MaximalityReport{Type: t, Maximal: true}
+	maxMultiplicity := 0
+	for _, m := range *t {
+		if m > maxMultiplicity {
+			maxMultiplicity = m
+		}
+	}
+	if maxMultiplicity < 2 {
+		report.Reasons = append(report.Reasons, "all cycle lengths are distinct, so no cycles can be merged")
+		return report
+	}
+	for _, p := range Primes(maxMultiplicity) {
+		if l, ok := t.pthRootObstruction(p); !ok {
+			report.Reasons = append(report.Reasons,
+				fmt.Sprintf("p=%d: %d cycles of length %d is not a multiple of %d", p, (*t)[l-1], l, p))
+			continue
+		}
+		report.Maximal = false
+		report.Prime = p
+		report.Root = t.pthRoot(p)
+		report.Reasons = append(report.Reasons,
+			fmt.Sprintf("p=%d: every length divisible by %d occurs a multiple of %d times, and some length occurs at least %d times", p, p, p, p))
+		break
+	}
+	return report
+}
+
+// pthRootObstruction checks condition (a) for the prime p, returning
+// the first length that violates it.  condition (b) is assumed.
+func (t *CycleType) pthRootObstruction(p int) (length int, ok bool) {
+	for l := p; l <= len(*t); l += p {
+		if (*t)[l-1]%p != 0 {
+			return l, false
+		}
+	}
+	return 0, true
+}
+
+// pthRoot returns a type u, with p dividing the order of u, such that
+// u^p = t.  assumes t satisfies (a) and (b) for p.  all cycles whose
+// length is divisible by p are merged in groups of p; if there are
+// none, a single group of the shortest length occurring at least p
+// times is merged.
+func (t *CycleType) pthRoot(p int) *CycleType {
+	u := t.Copy()
+	merged := false
+	for l := p; p*l <= len(*t); l += p {
+		if m := (*t)[l-1]; m > 0 {
+			(*u)[l-1] -= m
+			(*u)[p*l-1] += m / p
+			merged = true
+		}
+	}
+	if !merged {
+		for l := 1; p*l <= len(*t); l++ {
+			if (*u)[l-1] >= p {
+				(*u)[l-1] -= p
+				(*u)[p*l-1]++
+				break
+			}
+		}
+	}
+	return u
+}
+
+// IsPowerOf reports whether t = u^k for some k.  since u^k has order
+// ord(u)/gcd(k, ord(u)) and its type depends only on that gcd, the
+// only candidate exponent is ord(u)/ord(t).
+func (t *CycleType) IsPowerOf(u *CycleType) bool {
+	if t.Degree() != u.Degree() {
+		return false
+	}
+	orderT := t.OrderFactorization()
+	orderU := u.OrderFactorization()
+	if !orderT.Divides(orderU) {
+		return false
+	}
+	k := orderU.merge(orderT, func(a, b int) int { return a - b })
+	v := make(CycleType, u.Degree())
+	u.PowerFactorization(k, v)
+	return v.Equal(t)
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestIsMaximalAgreesWithExpanderV3(t *testing.T) {
+	maxDegree := 30
+	if testing.Short() {
+		maxDegree = 22
+	}
+	for d := 1; d <= maxDegree; d++ {
+		exp, err := NewExpanderV3(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := exp.Expand(); err != nil {
+			t.Fatal(err)
+		}
+		var ct CycleType = make([]int, d)
+		for i := 0; i < exp.Partitions().Len(); i++ {
+			exp.Partitions().At(i).CycleType(ct)
+			report := ct.ExplainMaximality()
+			if report.Maximal == exp.marked(i) {
+				t.Errorf("d=%d expander marked=%v but %v", d, exp.marked(i), report)
+			}
+			if report.Maximal {
+				continue
+			}
+			root := report.Root
+			if root.Degree() != d || root.DegreeOld() != d {
+				t.Errorf("d=%d root %v has wrong degree", d, root)
+			}
+			if root.OrderFactorization().Exponent(report.Prime) == 0 {
+				t.Errorf("d=%d prime %d does not divide the order of the root %v", d, report.Prime, root)
+			}
+			if u := root.PowerOld(report.Prime); !u.Equal(&ct) {
+				t.Errorf("d=%d %v but the power is %v", d, report, u)
+			}
+		}
+	}
+}
+
+func TestIsMaximalExamples(t *testing.T) {
+	tcase := func(ct CycleType, expected bool) {
+		if ct.IsMaximal() != expected {
+			t.Errorf("t=%v expected maximal=%v got %v", &ct, expected, ct.ExplainMaximality())
+		}
+	}
+	tcase(CycleType{1}, true)
+	tcase(CycleType{2, 0}, false)
+	tcase(CycleType{0, 1}, true)
+	tcase(CycleType{0, 2, 0, 0}, false) // (4)^2
+	tcase(CycleType{1, 0, 0, 1, 0}, true) // (4,1)
+	tcase(CycleType{0, 1, 1, 0, 0}, true) // (3,2)
+	tcase(CycleType{2, 0, 1, 0, 0}, false) // (3,2)^2
+}
+
+func TestIsPowerOf(t *testing.T) {
+	for i := 0; i < 2000; i++ {
+		d := 1 + rand.Intn(40)
+		u := RandomCycleType(d)
+		k := 1 + rand.Intn(1000)
+		v := u.PowerOld(k)
+		if !v.IsPowerOf(u) {
+			t.Errorf("u=%v k=%d expected %v to be a power of u", u, k, v)
+		}
+		w := RandomCycleType(d)
+		expected := false
+		order, err := w.Order()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j := 1; j <= order; j++ {
+			if w.PowerOld(j).Equal(u) {
+				expected = true
+				break
+			}
+		}
+		if u.IsPowerOf(w) != expected {
+			t.Errorf("u=%v w=%v expected IsPowerOf=%v", u, w, expected)
+		}
+	}
+}
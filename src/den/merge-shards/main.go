@@ -0,0 +1,39 @@
+// Copyright 2018 Adam Marks
+
+package main
+
+import (
+	"den"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+)
+
+// merge-shards combines the shard files written by expander -shard
+// into the width, density and number of maximal types of the degree.
+// the shards must cover the partitions with no gaps or overlaps.
+func main() {
+	var partitionFile string
+	var workers int
+
+	flag.StringVar(&partitionFile, "partitions", "", "partition file to map (see gen-partition-file)")
+	flag.IntVar(&workers, "workers", 0, "number of shards summed at once (0 for one per cpu)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] shard-file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	merge, err := den.MergeShardFiles(flag.Args(), partitionFile, workers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	density, _ := merge.Density().Float64()
+	fmt.Printf("#n shards NumMaximalTypesV3 WidthV3 DensityV3\n")
+	fmt.Printf("%d %d %d %v %v\n", merge.Degree, merge.Shards, merge.NumMaximalTypes, merge.Width, density)
+}
@@ -0,0 +1,338 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"encoding/json"
+	"expvar"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metrics is an Observer that keeps the state of a run degree by
+// degree, for a metrics endpoint and a run report, and passes every
+// event on to another observer.  of an ExpanderV3 it also samples the
+// marks, and takes the TimeTo* durations at the end of each phase.
+type Metrics struct {
+	next Observer
+	started time.Time
+
+	mu sync.Mutex
+	phase string // "" between phases
+	degree int
+	degrees map[int]*degreeMetrics
+}
+
+type degreeMetrics struct {
+	partitionsGenerated int
+	processed map[workerKey]int
+	marks markTable // sampled until the expansion is done
+	numMarks int
+	times map[string]time.Duration // TimeTo* of the expander
+	phases map[string]time.Duration
+}
+
+type workerKey struct {
+	phase string
+	worker int
+}
+
+// expanderWatcher is implemented by observers that also follow what
+// the events do not carry: the marks and the TimeTo* durations of an
+// ExpanderV3.
+type expanderWatcher interface {
+	watchMarks(degree int, marks markTable)
+	expanderTimes(degree int, times map[string]time.Duration)
+}
+
+// NewMetrics passes the events on to next; nil logs them.
+func NewMetrics(next Observer) *Metrics {
+	return &Metrics{
+		next: observerOrDefault(next),
+		started: time.Now(),
+		degrees: make(map[int]*degreeMetrics),
+	}
+}
+
+// MetricsReport is the state of a run, as the run report and the
+// expvar "den" hold it.
+type MetricsReport struct {
+	Phase string `json:"phase"`
+	Degree int `json:"degree"`
+	HeapBytes uint64 `json:"heap_bytes"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	Degrees []DegreeReport `json:"degrees"`
+}
+
+type DegreeReport struct {
+	Degree int `json:"n"`
+	PartitionsGenerated int `json:"partitions_generated"`
+	PartitionsProcessed []WorkerPartitions `json:"partitions_processed"`
+	Marks int `json:"marks"`
+	TimeSeconds map[string]float64 `json:"time_seconds"`
+	PhaseSeconds map[string]float64 `json:"phase_seconds"`
+}
+
+type WorkerPartitions struct {
+	Phase string `json:"phase"`
+	Worker int `json:"worker"`
+	Partitions int `json:"partitions"`
+}
+
+func (m *Metrics) degreeLocked(n int) *degreeMetrics {
+	d, found := m.degrees[n]
+	if !found {
+		d = &degreeMetrics{
+			processed: make(map[workerKey]int),
+			times: make(map[string]time.Duration),
+			phases: make(map[string]time.Duration),
+		}
+		m.degrees[n] = d
+	}
+	return d
+}
+
+func (m *Metrics) Phase(e PhaseEvent) {
+	m.mu.Lock()
+	d := m.degreeLocked(e.Degree)
+	m.degree = e.Degree
+	if e.Done {
+		m.phase = ""
+		d.phases[e.Phase] = e.Elapsed
+		switch e.Phase {
+		case PhaseGeneratingPartitions:
+			d.partitionsGenerated = e.Items
+		case PhaseExpanding:
+			d.freezeMarks()
+		}
+	} else {
+		m.phase = e.Phase
+	}
+	m.mu.Unlock()
+	m.next.Phase(e)
+}
+
+func (m *Metrics) Progress(e ProgressEvent) {
+	if e.Worker != NoWorker {
+		m.mu.Lock()
+		m.degreeLocked(e.Degree).processed[workerKey{e.Phase, e.Worker}] = e.WorkerDone
+		m.mu.Unlock()
+	}
+	m.next.Progress(e)
+}
+
+func (m *Metrics) Worker(e WorkerEvent) {
+	m.mu.Lock()
+	m.degreeLocked(e.Degree).processed[workerKey{e.Phase, e.Worker}] = e.Transactions
+	m.mu.Unlock()
+	m.next.Worker(e)
+}
+
+func (m *Metrics) Printf(format string, args ...interface{}) {
+	m.next.Printf(format, args...)
+}
+
+// watchMarks samples the marks of degree until its expansion is done;
+// those of any other degree are counted and let go.
+func (m *Metrics) watchMarks(degree int, marks markTable) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.degrees {
+		d.freezeMarks()
+	}
+	m.degreeLocked(degree).marks = marks
+}
+
+func (m *Metrics) expanderTimes(degree int, times map[string]time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := m.degreeLocked(degree)
+	for name, t := range times {
+		d.times[name] = t
+	}
+}
+
+func (d *degreeMetrics) freezeMarks() {
+	if d.marks.bits != nil {
+		d.numMarks = d.marks.numMarks()
+		d.marks = markTable{}
+	}
+}
+
+// Report returns the state of the run so far.
+func (m *Metrics) Report() *MetricsReport {
+	heap := HeapSize()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rep := &MetricsReport{
+		Phase: m.phase,
+		Degree: m.degree,
+		HeapBytes: heap,
+		ElapsedSeconds: time.Since(m.started).Seconds(),
+	}
+	for n, d := range m.degrees {
+		dr := DegreeReport{
+			Degree: n,
+			PartitionsGenerated: d.partitionsGenerated,
+			Marks: d.numMarks,
+			TimeSeconds: make(map[string]float64),
+			PhaseSeconds: make(map[string]float64),
+		}
+		if d.marks.bits != nil {
+			dr.Marks = d.marks.numMarks()
+		}
+		for k, x := range d.processed {
+			dr.PartitionsProcessed = append(dr.PartitionsProcessed, WorkerPartitions{k.phase, k.worker, x})
+		}
+		sort.Slice(dr.PartitionsProcessed, func(a, b int) bool {
+			p, q := dr.PartitionsProcessed[a], dr.PartitionsProcessed[b]
+			return p.Phase < q.Phase || (p.Phase == q.Phase && p.Worker < q.Worker)
+		})
+		for name, t := range d.times {
+			dr.TimeSeconds[name] = t.Seconds()
+		}
+		for phase, t := range d.phases {
+			dr.PhaseSeconds[phase] = t.Seconds()
+		}
+		rep.Degrees = append(rep.Degrees, dr)
+	}
+	sort.Slice(rep.Degrees, func(a, b int) bool { return rep.Degrees[a].Degree < rep.Degrees[b].Degree })
+	return rep
+}
+
+// WriteReport writes the report as json to path.  a nil Metrics or an
+// empty path writes nothing, as for a run that asked for no report.
+func (m *Metrics) WriteReport(path string) error {
+	if m == nil || path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(m.Report(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// WritePrometheus writes the report in the prometheus text format.
+func (m *Metrics) WritePrometheus(w io.Writer) (int64, error) {
+	rep := m.Report()
+	r := newRenderer(w)
+	family := func(name, help string) {
+		r.printf("# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	}
+	family("den_elapsed_seconds", "Seconds since the run began.")
+	r.printf("den_elapsed_seconds %g\n", rep.ElapsedSeconds)
+	family("den_heap_bytes", "Bytes of allocated heap objects.")
+	r.printf("den_heap_bytes %d\n", rep.HeapBytes)
+	family("den_phase", "The phase in hand, 1 while it lasts.")
+	if rep.Phase != "" {
+		r.printf("den_phase{n=\"%d\",phase=%q} 1\n", rep.Degree, rep.Phase)
+	}
+	family("den_partitions_generated", "Partitions generated or mapped for the degree.")
+	for _, d := range rep.Degrees {
+		r.printf("den_partitions_generated{n=\"%d\"} %d\n", d.Degree, d.PartitionsGenerated)
+	}
+	family("den_partitions_processed", "Partitions processed by each worker of a phase.")
+	for _, d := range rep.Degrees {
+		for _, p := range d.PartitionsProcessed {
+			r.printf("den_partitions_processed{n=\"%d\",phase=%q,worker=\"%d\"} %d\n",
+				d.Degree, p.Phase, p.Worker, p.Partitions)
+		}
+	}
+	family("den_marks", "Types marked as proper powers so far.")
+	for _, d := range rep.Degrees {
+		r.printf("den_marks{n=\"%d\"} %d\n", d.Degree, d.Marks)
+	}
+	family("den_time_seconds", "The TimeTo* durations of the expander of the degree.")
+	for _, d := range rep.Degrees {
+		for _, name := range sortedKeys(d.TimeSeconds) {
+			r.printf("den_time_seconds{n=\"%d\",name=%q} %g\n", d.Degree, name, d.TimeSeconds[name])
+		}
+	}
+	family("den_phase_seconds", "Seconds taken by each completed phase.")
+	for _, d := range rep.Degrees {
+		for _, phase := range sortedKeys(d.PhaseSeconds) {
+			r.printf("den_phase_seconds{n=\"%d\",phase=%q} %g\n", d.Degree, phase, d.PhaseSeconds[phase])
+		}
+	}
+	return r.done()
+}
+
+func sortedKeys(m map[string]float64) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Handler serves the metrics at /metrics in the prometheus text
+// format, and with the other expvars as "den" at /debug/vars.
+func (m *Metrics) Handler() http.Handler {
+	publishMetrics(m)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		m.WritePrometheus(w)
+	})
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+// ServeMetrics serves the metrics on addr until the process exits, and
+// returns the address listened on.
+func ServeMetrics(addr string, m *Metrics) (net.Addr, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go http.Serve(l, m.Handler())
+	return l.Addr(), nil
+}
+
+// StartMetrics returns the Metrics a command reports through, passing
+// the events on to next, if metrics are served on addr or a report is
+// to be written; otherwise nil, which WriteReport accepts.
+func StartMetrics(next Observer, addr, report string) (*Metrics, error) {
+	if addr == "" && report == "" {
+		return nil, nil
+	}
+	m := NewMetrics(next)
+	if addr != "" {
+		a, err := ServeMetrics(addr, m)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("serving metrics; addr=http://%v/metrics", a)
+	}
+	return m, nil
+}
+
+// expvar names are global, so "den" is published once and reports the
+// Metrics of the latest Handler.
+var published struct {
+	sync.Mutex
+	once sync.Once
+	metrics *Metrics
+}
+
+func publishMetrics(m *Metrics) {
+	published.Lock()
+	published.metrics = m
+	published.Unlock()
+	published.once.Do(func() {
+		expvar.Publish("den", expvar.Func(func() interface{} {
+			published.Lock()
+			m := published.metrics
+			published.Unlock()
+			return m.Report()
+		}))
+	})
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMetricsReport(t *testing.T) {
+	m := NewMetrics(DiscardObserver{})
+	exp, err := NewExpanderV3(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.SetNumWorkers(3)
+	exp.SetObserver(m)
+	exp.Width()
+	next, err := exp.Extend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	next.Width()
+
+	rep := m.Report()
+	if rep.Phase != "" || rep.Degree != 21 || rep.HeapBytes == 0 || len(rep.Degrees) != 2 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+	for i, e := range []*ExpanderV3{exp, next} {
+		d := rep.Degrees[i]
+		size := e.Partitions().Len()
+		processed := make(map[string]int)
+		for _, p := range d.PartitionsProcessed {
+			processed[p.Phase] += p.Partitions
+		}
+		expanded := size - e.firstNew
+		if d.Degree != e.Degree() || d.PartitionsGenerated != size || d.Marks != size-e.NumMaximalTypes() ||
+			processed[PhaseExpanding] != expanded || processed[PhaseSummingWidth] != size {
+			t.Errorf("n=%d; expected parts=%d marks=%d expanded=%d got %+v",
+				e.Degree(), size, size-e.NumMaximalTypes(), expanded, d)
+		}
+		if _, found := d.TimeSeconds["TimeToExpand"]; !found {
+			t.Errorf("n=%d; expected TimeToExpand in %v", e.Degree(), d.TimeSeconds)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := m.WriteReport(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got MetricsReport
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got.Degrees) != fmt.Sprint(rep.Degrees) {
+		t.Errorf("report does not round trip; expected=%v got=%v", rep.Degrees, got.Degrees)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	m := NewMetrics(DiscardObserver{})
+	exp, err := NewExpanderV3(12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.SetObserver(m)
+	exp.NumMaximalTypes()
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+
+	get := func(path string) string {
+		resp, err := server.Client().Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil || resp.StatusCode != 200 {
+			t.Fatalf("path=%s status=%d err=%v", path, resp.StatusCode, err)
+		}
+		return string(b)
+	}
+	text := get("/metrics")
+	for _, line := range []string{
+		"# TYPE den_marks gauge",
+		fmt.Sprintf("den_marks{n=\"12\"} %d", exp.Partitions().Len()-exp.NumMaximalTypes()),
+		fmt.Sprintf("den_partitions_generated{n=\"12\"} %d", exp.Partitions().Len()),
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("expected %q in\n%s", line, text)
+		}
+	}
+	var vars struct {
+		Den MetricsReport `json:"den"`
+	}
+	if err := json.Unmarshal([]byte(get("/debug/vars")), &vars); err != nil {
+		t.Fatal(err)
+	}
+	if len(vars.Den.Degrees) != 1 || vars.Den.Degrees[0].Degree != 12 {
+		t.Errorf("unexpected expvar den=%+v", vars.Den)
+	}
+}
+
+func TestStartMetrics(t *testing.T) {
+	m, err := StartMetrics(nil, "", "")
+	if err != nil || m != nil {
+		t.Fatalf("expected no metrics unless asked; m=%v err=%v", m, err)
+	}
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := m.WriteReport(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no report from nil metrics; err=%v", err)
+	}
+	m, err = StartMetrics(DiscardObserver{}, "", path)
+	if err != nil || m == nil {
+		t.Fatalf("expected metrics for a report; err=%v", err)
+	}
+	if err := m.WriteReport(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Error(err)
+	}
+	if _, err := StartMetrics(nil, "bad address", ""); err == nil {
+		t.Errorf("expected an error serving on a bad address")
+	}
+}
@@ -0,0 +1,406 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sync"
+)
+
+// number theory on factorized integers.  the order of a cycle type is
+// the LCM of its cycle lengths, which outgrows 64 bits for degrees in
+// the hundreds, so orders are carried as prime factorizations and
+// only converted to big.Int when an exact value is needed.
+
+type PrimePower struct {
+	Prime int
+	Exponent int
+}
+
+// Factorization is a positive integer written as a product of prime
+// powers with strictly ascending primes and positive exponents.  the
+// empty factorization is 1.  factorizations are treated as immutable
+// values: operations return new factorizations and may share storage
+// with their arguments.
+type Factorization []PrimePower
+
+// Primes returns the primes <= n, by the sieve of eratosthenes.
+func Primes(n int) []int {
+	return NewPrimeSieve(n).Primes()
+}
+
+// PrimeSieve records the smallest prime factor of every integer up to
+// its limit, which makes factoring small integers (cycle lengths,
+// exponents) a table walk.
+type PrimeSieve struct {
+	spf []int // spf[a] is the smallest prime dividing a, for a >= 2
+}
+
+func NewPrimeSieve(limit int) *PrimeSieve {
+	if limit < 1 {
+		limit = 1
+	}
+	spf := make([]int, limit+1)
+	for p := 2; p <= limit; p++ {
+		if spf[p] != 0 {
+			continue
+		}
+		for q := p; q <= limit; q += p {
+			if spf[q] == 0 {
+				spf[q] = p
+			}
+		}
+	}
+	return &PrimeSieve{spf: spf}
+}
+
+func (s *PrimeSieve) Limit() int {
+	return len(s.spf) - 1
+}
+
+func (s *PrimeSieve) IsPrime(a int) bool {
+	return a >= 2 && a <= s.Limit() && s.spf[a] == a
+}
+
+func (s *PrimeSieve) Primes() []int {
+	primes := make([]int, 0)
+	for a := 2; a <= s.Limit(); a++ {
+		if s.spf[a] == a {
+			primes = append(primes, a)
+		}
+	}
+	return primes
+}
+
+// Factor factors a >= 1, using the table when a is within the limit
+// of the sieve and trial division otherwise.
+func (s *PrimeSieve) Factor(a int) Factorization {
+	if a < 1 {
+		panic(fmt.Sprintf("cannot factor %d", a))
+	}
+	if a > s.Limit() {
+		return trialFactor(a)
+	}
+	f := make(Factorization, 0)
+	for a > 1 {
+		p := s.spf[a]
+		e := 0
+		for a%p == 0 {
+			a /= p
+			e++
+		}
+		f = append(f, PrimePower{p, e})
+	}
+	return f
+}
+
+func trialFactor(a int) Factorization {
+	f := make(Factorization, 0)
+	for p := 2; p*p <= a; p++ {
+		if a%p != 0 {
+			continue
+		}
+		e := 0
+		for a%p == 0 {
+			a /= p
+			e++
+		}
+		f = append(f, PrimePower{p, e})
+	}
+	if a > 1 {
+		f = append(f, PrimePower{a, 1})
+	}
+	return f
+}
+
+// factorizations of small integers are cached, since every cycle
+// length of every type gets factored.
+const smallFactorizationLimit = 1 << 12
+
+var smallFactorizations []Factorization = func() []Factorization {
+	s := NewPrimeSieve(smallFactorizationLimit)
+	f := make([]Factorization, smallFactorizationLimit+1)
+	for a := 1; a <= smallFactorizationLimit; a++ {
+		f[a] = s.Factor(a)
+	}
+	return f
+}()
+
+// Factor returns the factorization of a >= 1.
+func Factor(a int) Factorization {
+	if a >= 1 && a <= smallFactorizationLimit {
+		return smallFactorizations[a]
+	}
+	if a < 1 {
+		panic(fmt.Sprintf("cannot factor %d", a))
+	}
+	return trialFactor(a)
+}
+
+func (f Factorization) IsOne() bool {
+	return len(f) == 0
+}
+
+func (f Factorization) Equal(g Factorization) bool {
+	if len(f) != len(g) {
+		return false
+	}
+	for i := range f {
+		if f[i] != g[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Exponent returns the exponent of the prime p in f, zero if p does
+// not divide f.
+func (f Factorization) Exponent(p int) int {
+	for _, x := range f {
+		if x.Prime == p {
+			return x.Exponent
+		}
+		if x.Prime > p {
+			break
+		}
+	}
+	return 0
+}
+
+// PrimeDivisors returns the distinct primes dividing f, ascending.
+func (f Factorization) PrimeDivisors() []int {
+	primes := make([]int, len(f))
+	for i, x := range f {
+		primes[i] = x.Prime
+	}
+	return primes
+}
+
+// merge walks the union of the primes of f and g, combining exponents
+// with op and dropping zero results.
+func (f Factorization) merge(g Factorization, op func(a, b int) int) Factorization {
+	h := make(Factorization, 0, len(f)+len(g))
+	i, j := 0, 0
+	for i < len(f) || j < len(g) {
+		var p, a, b int
+		switch {
+		case j == len(g) || (i < len(f) && f[i].Prime < g[j].Prime):
+			p, a = f[i].Prime, f[i].Exponent
+			i++
+		case i == len(f) || g[j].Prime < f[i].Prime:
+			p, b = g[j].Prime, g[j].Exponent
+			j++
+		default:
+			p, a, b = f[i].Prime, f[i].Exponent, g[j].Exponent
+			i++
+			j++
+		}
+		if e := op(a, b); e > 0 {
+			h = append(h, PrimePower{p, e})
+		}
+	}
+	return h
+}
+
+func (f Factorization) Mul(g Factorization) Factorization {
+	return f.merge(g, func(a, b int) int { return a + b })
+}
+
+func (f Factorization) LCM(g Factorization) Factorization {
+	return f.merge(g, func(a, b int) int {
+		if a > b {
+			return a
+		}
+		return b
+	})
+}
+
+func (f Factorization) GCD(g Factorization) Factorization {
+	return f.merge(g, func(a, b int) int {
+		if a < b {
+			return a
+		}
+		return b
+	})
+}
+
+// Divides reports whether f divides g.
+func (f Factorization) Divides(g Factorization) bool {
+	for _, x := range f {
+		if g.Exponent(x.Prime) < x.Exponent {
+			return false
+		}
+	}
+	return true
+}
+
+// GCDInt returns gcd(f, a) for a positive machine integer a.  the
+// result divides a, so it cannot overflow.
+func (f Factorization) GCDInt(a int) int {
+	g := 1
+	for _, x := range f {
+		for e := 0; e < x.Exponent && a%x.Prime == 0; e++ {
+			a /= x.Prime
+			g *= x.Prime
+		}
+	}
+	return g
+}
+
+// Divisors enumerates every divisor of f, including 1 and f itself.
+func (f Factorization) Divisors() []Factorization {
+	divisors := []Factorization{Factorization{}}
+	for _, x := range f {
+		L := len(divisors)
+		for e := 1; e <= x.Exponent; e++ {
+			for _, d := range divisors[:L] {
+				q := make(Factorization, len(d), len(d)+1)
+				copy(q, d)
+				divisors = append(divisors, append(q, PrimePower{x.Prime, e}))
+			}
+		}
+	}
+	return divisors
+}
+
+// NumDivisors returns the number of divisors of f.
+func (f Factorization) NumDivisors() int {
+	k := 1
+	for _, x := range f {
+		k *= x.Exponent + 1
+	}
+	return k
+}
+
+// Int returns the exact value of f.
+func (f Factorization) Int() *big.Int {
+	z := big.NewInt(1)
+	for _, x := range f {
+		z.Mul(z, Exp(x.Prime, x.Exponent))
+	}
+	return z
+}
+
+// Int64 returns the value of f and true, or zero and false if the
+// value does not fit in an int64.
+func (f Factorization) Int64() (int64, bool) {
+	var z int64 = 1
+	for _, x := range f {
+		for e := 0; e < x.Exponent; e++ {
+			if z > math.MaxInt64/int64(x.Prime) {
+				return 0, false
+			}
+			z *= int64(x.Prime)
+		}
+	}
+	return z, true
+}
+
+// Totient returns euler's totient of f: prod p^(e-1) * (p-1).
+func (f Factorization) Totient() *big.Int {
+	return f.JordanTotient(1)
+}
+
+// JordanTotient returns the jordan totient J_k of f: the number of
+// k-tuples of integers in [1, f] whose gcd with f is 1, equal to
+// prod p^(k(e-1)) * (p^k - 1).  J_1 is euler's totient.
+func (f Factorization) JordanTotient(k int) *big.Int {
+	z := big.NewInt(1)
+	for _, x := range f {
+		pk := Exp(x.Prime, k)
+		if x.Exponent > 1 {
+			z.Mul(z, Exp(x.Prime, k*(x.Exponent-1)))
+		}
+		z.Mul(z, pk.Sub(pk, bigOne))
+	}
+	return z
+}
+
+func (f Factorization) String() string {
+	if f.IsOne() {
+		return "1"
+	}
+	var s string
+	for i, x := range f {
+		if i > 0 {
+			s += "*"
+		}
+		s += fmt.Sprintf("%d", x.Prime)
+		if x.Exponent > 1 {
+			s += fmt.Sprintf("^%d", x.Exponent)
+		}
+	}
+	return s
+}
+
+// FactorBig factors a >= 1 by trial division.  it is meant for
+// integers whose prime factors are small, such as group orders, and
+// panics on a prime factor beyond the int32 range, or a cofactor that
+// trialFactorBig cannot settle.
+func FactorBig(a *big.Int) Factorization {
+	if a.Sign() < 1 {
+		panic(fmt.Sprintf("cannot factor %v", a))
+	}
+	f, rest, err := trialFactorBig(a)
+	if err != nil {
+		panic(err)
+	}
+	if rest.Cmp(bigOne) != 0 {
+		panic(fmt.Sprintf("cannot factor %v; large prime factor %v", a, rest))
+	}
+	return f
+}
+
+// trial division of big integers stops at the primes up to
+// trialFactorLimit, sieved the first time they are needed.
+const trialFactorLimit = 1 << 20
+
+var trialPrimes = sync.OnceValue(func() []int { return Primes(trialFactorLimit) })
+
+// trialFactorBig divides a >= 1 by the primes up to trialFactorLimit,
+// or its square root if that is less, and returns what is left over: 1,
+// or a prime beyond the int32 range.  a leftover is known prime if it
+// is below the square of the limit, or below 2^64 where ProbablyPrime
+// is exact; any other leftover is an error.  the cost is one big
+// division per prime up to min(sqrt(a), trialFactorLimit).
+func trialFactorBig(a *big.Int) (Factorization, *big.Int, error) {
+	if a.IsInt64() && a.Int64() <= math.MaxInt32 {
+		return Factor(int(a.Int64())), big.NewInt(1), nil
+	}
+	f := make(Factorization, 0)
+	z := new(big.Int).Set(a)
+	q, r, bp := new(big.Int), new(big.Int), new(big.Int)
+	for _, p := range trialPrimes() {
+		bp.SetInt64(int64(p))
+		if r.Mul(bp, bp).Cmp(z) > 0 {
+			break
+		}
+		e := 0
+		for {
+			q.QuoRem(z, bp, r)
+			if r.Sign() != 0 {
+				break
+			}
+			z.Set(q)
+			e++
+		}
+		if e > 0 {
+			f = append(f, PrimePower{p, e})
+		}
+	}
+	if z.Cmp(bigOne) == 0 {
+		return f, z, nil
+	}
+	limit := big.NewInt(trialFactorLimit)
+	if z.Cmp(limit.Mul(limit, limit)) >= 0 && !(z.IsUint64() && z.ProbablyPrime(0)) {
+		return nil, nil, fmt.Errorf("cannot factor %v; cofactor %v has no prime factor up to %d and is not known prime",
+			a, z, trialFactorLimit)
+	}
+	if z.IsInt64() && z.Int64() <= math.MaxInt32 {
+		f = append(f, PrimePower{int(z.Int64()), 1})
+		z.SetInt64(1)
+	}
+	return f, z, nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestPrimes(t *testing.T) {
+	primes := Primes(50)
+	expected := []int{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47}
+	if !intSlicesEqual(primes, expected) {
+		t.Errorf("expected=%v got=%v", expected, primes)
+	}
+	if len(Primes(1)) != 0 {
+		t.Errorf("expected no primes <= 1")
+	}
+}
+
+func TestFactor(t *testing.T) {
+
+	tcase := func(a int, expected string) {
+
+		f := Factor(a)
+
+		if f.String() != expected {
+			t.Errorf("Factor(%v) expected=%v got=%v", a, expected, f)
+		}
+		if f.Int().Cmp(big.NewInt(int64(a))) != 0 {
+			t.Errorf("Factor(%v).Int() got=%v", a, f.Int())
+		}
+	}
+
+	tcase(1, "1")
+	tcase(2, "2")
+	tcase(12, "2^2*3")
+	tcase(97, "97")
+	tcase(360, "2^3*3^2*5")
+	tcase(4097, "17*241") // beyond the cached range
+	tcase(1000000007, "1000000007")
+}
+
+func TestFactorBig(t *testing.T) {
+	a := Factorial(30)
+	f := FactorBig(a)
+	if f.Int().Cmp(a) != 0 {
+		t.Errorf("FactorBig(30!) expected=%v got=%v=%v", a, f, f.Int())
+	}
+	if f.Exponent(2) != 26 {
+		t.Errorf("expected 2^26 || 30! got=%v", f)
+	}
+}
+
+func TestTotientLargePrimeFactor(t *testing.T) {
+	q := big.NewInt(4294967311) // the least prime above 2^32
+	if !q.ProbablyPrime(20) {
+		t.Fatalf("%v is not prime", q)
+	}
+	a := new(big.Int).Mul(q, big.NewInt(12))
+	expected := new(big.Int).Mul(new(big.Int).Sub(q, bigOne), big.NewInt(4))
+	got := big.NewInt(0)
+	if err := Totient(a, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Cmp(expected) != 0 {
+		t.Errorf("Totient(%v) expected=%v got=%v", a, expected, got)
+	}
+	// cofactors with no prime factor up to trialFactorLimit that are not
+	// known prime: a semiprime within 64 bits, and one beyond
+	for _, b := range []*big.Int{
+		new(big.Int).Mul(big.NewInt(2097143), big.NewInt(2097169)),
+		new(big.Int).Mul(q, q),
+	} {
+		if err := Totient(b, got); err == nil {
+			t.Errorf("Totient(%v) expected error got=%v", b, got)
+		}
+	}
+}
+
+func TestFactorizationLCMAndGCD(t *testing.T) {
+	for a := 1; a <= 60; a++ {
+		for b := 1; b <= 60; b++ {
+			g := Factor(a).GCD(Factor(b))
+			l := Factor(a).LCM(Factor(b))
+			if x, _ := g.Int64(); int(x) != GCD(a, b) {
+				t.Errorf("gcd a=%d b=%d expected=%d got=%v", a, b, GCD(a, b), g)
+			}
+			if x, _ := l.Int64(); int(x) != a*b/GCD(a, b) {
+				t.Errorf("lcm a=%d b=%d expected=%d got=%v", a, b, a*b/GCD(a, b), l)
+			}
+			if x, _ := Factor(a).Mul(Factor(b)).Int64(); int(x) != a*b {
+				t.Errorf("mul a=%d b=%d got=%v", a, b, x)
+			}
+			if Factor(a).GCDInt(b) != GCD(a, b) {
+				t.Errorf("GCDInt a=%d b=%d got=%d", a, b, Factor(a).GCDInt(b))
+			}
+			if Factor(a).Divides(Factor(b)) != (b%a == 0) {
+				t.Errorf("Divides a=%d b=%d", a, b)
+			}
+		}
+	}
+}
+
+func TestDivisorsAndTotients(t *testing.T) {
+	for a := 1; a <= 500; a++ {
+		f := Factor(a)
+		divisors := f.Divisors()
+		var expected int
+		for d := 1; d <= a; d++ {
+			if a%d == 0 {
+				expected++
+			}
+		}
+		if len(divisors) != expected || f.NumDivisors() != expected {
+			t.Errorf("a=%d expected %d divisors got=%v", a, expected, divisors)
+		}
+		for _, d := range divisors {
+			if !d.Divides(f) {
+				t.Errorf("a=%d not divisible by %v", a, d)
+			}
+		}
+		// count k-tuples coprime with a by brute force for k = 1, 2
+		var j1, j2 int64
+		for x := 1; x <= a; x++ {
+			if GCD(x, a) == 1 {
+				j1++
+			}
+			if a <= 100 {
+				for y := 1; y <= a; y++ {
+					if GCD(GCD(x, y), a) == 1 {
+						j2++
+					}
+				}
+			}
+		}
+		if f.Totient().Cmp(big.NewInt(j1)) != 0 {
+			t.Errorf("a=%d expected totient=%v got=%v", a, j1, f.Totient())
+		}
+		if a <= 100 && f.JordanTotient(2).Cmp(big.NewInt(j2)) != 0 {
+			t.Errorf("a=%d expected J_2=%v got=%v", a, j2, f.JordanTotient(2))
+		}
+		slow := big.NewInt(0)
+		if err := Totient(big.NewInt(int64(a)), slow); err != nil {
+			t.Fatal(err)
+		}
+		if f.Totient().Cmp(slow) != 0 {
+			t.Errorf("a=%d Totient expected=%v got=%v", a, f.Totient(), slow)
+		}
+	}
+}
+
+func TestInt64Overflow(t *testing.T) {
+	f := Factor(2).Mul(Factor(1 << 30)).Mul(Factor(1 << 30)).Mul(Factor(1 << 2))
+	if _, ok := f.Int64(); ok {
+		t.Errorf("expected 2^63 to overflow int64")
+	}
+}
+
+func TestOrderFactorizationLargeDegree(t *testing.T) {
+	// a type with one cycle of each prime length up to 300 has an
+	// order far beyond 64 bits.
+	d := 0
+	for _, p := range Primes(300) {
+		d += p
+	}
+	var ct CycleType = make([]int, d)
+	expected := big.NewInt(1)
+	for _, p := range Primes(300) {
+		ct[p-1] = 1
+		expected.Mul(expected, big.NewInt(int64(p)))
+	}
+	order := big.NewInt(0)
+	ct.Orderb(order)
+	if order.Cmp(expected) != 0 {
+		t.Errorf("expected=%v got=%v", expected, order)
+	}
+}
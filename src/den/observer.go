@@ -0,0 +1,192 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Observer follows a long computation of ExpanderV3, CPT, AbelTable,
+// a Coordinator or an ExpanderWorker: the start and end of each phase,
+// the items done within it, and at the end of a parallel phase the
+// statistics of each worker.  calls for one phase come one at a time,
+// from the goroutines doing the work, so they should return quickly.
+// Printf takes the remaining notes the computations used to log.
+type Observer interface {
+	Phase(e PhaseEvent)
+	Progress(e ProgressEvent)
+	Worker(e WorkerEvent)
+	Printf(format string, args ...interface{})
+}
+
+const (
+	PhaseGeneratingPartitions = "generating partitions"
+	PhaseExpanding = "expanding"
+	PhaseSummingWidth = "summing width"
+	PhaseGeneratingRows = "generating rows"
+)
+
+type PhaseEvent struct {
+	Phase string
+	Degree int
+	Done bool // false at the start of the phase
+	Elapsed time.Duration // when done
+	Items int // when done; as for ProgressEvent
+}
+
+// ProgressEvent counts the items of the phase done so far, partitions
+// for the expanders and rows for the tables, and of those the items
+// done by the worker whose chunk just completed, if any.  the ETA is
+// extrapolated from the rate so far, and is 0 until something is done.
+type ProgressEvent struct {
+	Phase string
+	Degree int
+	Done, Total int
+	Worker int // NoWorker for a phase without workers
+	WorkerDone int
+	Elapsed time.Duration
+	ETA time.Duration
+}
+
+const NoWorker = -1
+
+// WorkerEvent is the workerResult of one worker of a phase.
+type WorkerEvent struct {
+	Phase string
+	Degree int
+	Worker int
+	Transactions int
+	Rate float64 // transactions per second
+	Chunks int
+	Steals int
+	Finished time.Duration // since the work was distributed
+}
+
+// LogObserver logs through the log package, the progress at most once
+// per interval.  it is what the computations use unless given another.
+type LogObserver struct {
+	interval time.Duration
+	mu sync.Mutex
+	last time.Time
+}
+
+// DefaultProgressInterval is the interval of the default LogObserver.
+const DefaultProgressInterval = time.Minute
+
+var defaultObserver Observer = NewLogObserver(DefaultProgressInterval)
+
+func NewLogObserver(interval time.Duration) *LogObserver {
+	return &LogObserver{interval: interval}
+}
+
+func (o *LogObserver) Phase(e PhaseEvent) {
+	if e.Done {
+		log.Printf("done %s; n=%d time=%v", e.Phase, e.Degree, int(e.Elapsed.Seconds()))
+	} else {
+		log.Printf("begin %s; n=%d", e.Phase, e.Degree)
+	}
+}
+
+func (o *LogObserver) Progress(e ProgressEvent) {
+	o.mu.Lock()
+	if time.Since(o.last) < o.interval {
+		o.mu.Unlock()
+		return
+	}
+	o.last = time.Now()
+	o.mu.Unlock()
+	log.Printf("progress %s; n=%d done=%d/%d time=%v eta=%v", e.Phase, e.Degree, e.Done, e.Total,
+		int(e.Elapsed.Seconds()), int(e.ETA.Seconds()))
+}
+
+func (o *LogObserver) Worker(e WorkerEvent) {
+	log.Printf("worker %d result: transactions=%d tps=%d chunks=%d steals=%d done=%v", e.Worker,
+		e.Transactions, int(e.Rate), e.Chunks, e.Steals, e.Finished)
+}
+
+func (o *LogObserver) Printf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
+
+// DiscardObserver silences a computation.
+type DiscardObserver struct{}
+
+func (DiscardObserver) Phase(e PhaseEvent) {}
+func (DiscardObserver) Progress(e ProgressEvent) {}
+func (DiscardObserver) Worker(e WorkerEvent) {}
+func (DiscardObserver) Printf(format string, args ...interface{}) {}
+
+func observerOrDefault(o Observer) Observer {
+	if o == nil {
+		return defaultObserver
+	}
+	return o
+}
+
+func beginPhase(o Observer, phase string, degree int) time.Time {
+	o.Phase(PhaseEvent{Phase: phase, Degree: degree})
+	return time.Now()
+}
+
+func endPhase(o Observer, phase string, degree, items int, t0 time.Time) time.Duration {
+	elapsed := time.Since(t0)
+	o.Phase(PhaseEvent{Phase: phase, Degree: degree, Done: true, Elapsed: elapsed, Items: items})
+	return elapsed
+}
+
+// progressReporter returns a function that reports done of total
+// items of a phase begun now, workerDone of them by worker.
+func progressReporter(o Observer, phase string, degree, total int) func(worker, workerDone, done int) {
+	t0 := time.Now()
+	return func(worker, workerDone, done int) {
+		e := ProgressEvent{
+			Phase: phase,
+			Degree: degree,
+			Done: done,
+			Total: total,
+			Worker: worker,
+			WorkerDone: workerDone,
+			Elapsed: time.Since(t0),
+		}
+		if done > 0 {
+			e.ETA = time.Duration(float64(e.Elapsed) * float64(total-done) / float64(done))
+		}
+		o.Progress(e)
+	}
+}
+
+// mergeDone returns a channel closed once a or b is, either of which
+// may be nil, and a function to release it.
+func mergeDone(a, b <-chan struct{}) (<-chan struct{}, func()) {
+	if a == nil {
+		return b, func() {}
+	}
+	if b == nil {
+		return a, func() {}
+	}
+	ch := make(chan struct{})
+	quit := make(chan struct{})
+	go func() {
+		select {
+		case <-a:
+		case <-b:
+		case <-quit:
+			return
+		}
+		close(ch)
+	}()
+	return ch, func() { close(quit) }
+}
+
+// canceled turns ErrInterrupted from a computation run under ctx into
+// the error of ctx, unless it was the interrupt channel that fired.
+// other errors pass through.
+func canceled(ctx context.Context, err error) error {
+	if err == ErrInterrupted && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
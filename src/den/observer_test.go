@@ -0,0 +1,181 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"testing"
+)
+
+// recordingObserver keeps the phases as "begin x" and "done x", the
+// last progress of each phase and the worker events.
+type recordingObserver struct {
+	sync.Mutex
+	phases []string
+	progress map[string]ProgressEvent
+	workers []WorkerEvent
+	onProgress func()
+}
+
+func newRecordingObserver() *recordingObserver {
+	return &recordingObserver{progress: make(map[string]ProgressEvent)}
+}
+
+func (o *recordingObserver) Phase(e PhaseEvent) {
+	o.Lock()
+	defer o.Unlock()
+	if e.Done {
+		o.phases = append(o.phases, "done "+e.Phase)
+	} else {
+		o.phases = append(o.phases, "begin "+e.Phase)
+	}
+}
+
+func (o *recordingObserver) Progress(e ProgressEvent) {
+	o.Lock()
+	o.progress[e.Phase] = e
+	f := o.onProgress
+	o.Unlock()
+	if f != nil {
+		f()
+	}
+}
+
+func (o *recordingObserver) Worker(e WorkerEvent) {
+	o.Lock()
+	defer o.Unlock()
+	o.workers = append(o.workers, e)
+}
+
+func (o *recordingObserver) Printf(format string, args ...interface{}) {}
+
+func TestExpanderV3Observer(t *testing.T) {
+	d := 20
+	o := newRecordingObserver()
+	exp, err := NewExpanderV3(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.SetNumWorkers(3)
+	exp.SetObserver(o)
+	exp.Width()
+	expected := fmt.Sprint([]string{
+		"begin " + PhaseGeneratingPartitions, "done " + PhaseGeneratingPartitions,
+		"begin " + PhaseExpanding, "done " + PhaseExpanding,
+		"begin " + PhaseSummingWidth, "done " + PhaseSummingWidth,
+	})
+	if got := fmt.Sprint(o.phases); got != expected {
+		t.Errorf("expected phases=%s got=%s", expected, got)
+	}
+	size := exp.Partitions().Len()
+	for _, phase := range []string{PhaseExpanding, PhaseSummingWidth} {
+		e := o.progress[phase]
+		if e.Done != size || e.Total != size || e.ETA != 0 || e.Degree != d {
+			t.Errorf("phase=%s expected done=total=%d eta=0 got %+v", phase, size, e)
+		}
+	}
+	transactions := 0
+	for _, e := range o.workers {
+		transactions += e.Transactions
+	}
+	if len(o.workers) != 3 || transactions != size {
+		t.Errorf("expected 3 workers and %d transactions; got %d and %d", size, len(o.workers), transactions)
+	}
+}
+
+func TestDiscardObserverIsSilent(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	exp, err := NewExpanderV3(12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.SetObserver(DiscardObserver{})
+	exp.Width()
+	next, err := exp.Extend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	next.Width()
+	cpt, err := New_CPT(12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpt.SetObserver(DiscardObserver{})
+	if err := cpt.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	tab, err := NewAbelTable(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab.Observer = DiscardObserver{}
+	tab.Generate()
+	if buf.Len() != 0 {
+		t.Errorf("expected no log output; got %q", buf.String())
+	}
+}
+
+func TestExpanderV3Cancel(t *testing.T) {
+	d := 30
+	if testing.Short() {
+		d = 24
+	}
+	expected, err := NewExpanderV3(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected.SetObserver(DiscardObserver{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	o := newRecordingObserver()
+	o.onProgress = cancel
+	exp, err := NewExpanderV3(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.SetNumWorkers(2)
+	exp.SetObserver(o)
+	if err := exp.ExpandContext(ctx); err != context.Canceled {
+		t.Fatalf("expected err=%v got=%v", context.Canceled, err)
+	}
+	e := o.progress[PhaseExpanding]
+	if e.Done >= e.Total {
+		t.Errorf("expected the expansion to stop early; done=%d total=%d", e.Done, e.Total)
+	}
+	if _, err := exp.WidthContext(ctx); err != context.Canceled {
+		t.Errorf("expected err=%v got=%v", context.Canceled, err)
+	}
+	o.onProgress = nil
+	width, err := exp.WidthContext(context.Background())
+	if err != nil || width.Cmp(expected.Width()) != 0 || exp.NumMaximalTypes() != expected.NumMaximalTypes() {
+		t.Errorf("expected width=%v after cancel got=%v err=%v", expected.Width(), width, err)
+	}
+}
+
+func TestCPTAndAbelTableCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cpt, err := New_CPT(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpt.SetObserver(DiscardObserver{})
+	if err := cpt.GenerateContext(ctx); err != context.Canceled {
+		t.Errorf("cpt: expected err=%v got=%v", context.Canceled, err)
+	}
+	tab, err := NewAbelTable(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab.Observer = DiscardObserver{}
+	if err := tab.GenerateContext(ctx); err != context.Canceled {
+		t.Errorf("abel: expected err=%v got=%v", context.Canceled, err)
+	}
+}
@@ -5,10 +5,11 @@ package den
 import (
 	"fmt"
 	"sort"
-	"time"
 )
 
-type Partition []int // xxx change this from int to uint8; add assertion in AllPartitions to verify n <= 255.  make an alias for uint8 to PartitionInt.
+// parts are ascending.  see PartitionStore/PackedPartition for the
+// compact byte form used to hold all partitions of n.
+type Partition []int
 
 
 func (p Partition) String() string {
@@ -65,10 +66,11 @@ func (p Partition) Equal(q Partition) bool {
 	return false
 }
 
-// AllPartitions spawns a goroutine that generates the partitions and
-// emits them on the returned channel as they are generated.  when all
-// partitions have been generated, the goroutine ends and the channel
-// is closed.
+// YieldAllPartitions spawns a goroutine that generates the partitions
+// and emits them on the returned channel as they are generated.  when
+// all partitions have been generated, the goroutine ends and the
+// channel is closed.  PartitionIterator and ForEachPartition do the
+// same without the goroutine, channel or a copy per partition.
 func YieldAllPartitions(degree int) chan Partition {
 	yield := make(chan Partition, 100)
 	go func() {
@@ -78,55 +80,109 @@ func YieldAllPartitions(degree int) chan Partition {
 	return yield
 }
 
+// AllPartitions returns the partitions of degree in ruleAsc order.
+// they share one backing array, capped so that appending to one
+// cannot overwrite the next.
 func AllPartitions(degree int) []Partition {
-	count := CountAllPartitions(degree)
-	partitions := make([]Partition, count)
-	var yield chan Partition = YieldAllPartitions(degree)
-	i := 0
-	for p := range yield {
-		partitions[i] = p
-		i++
-	}
+	partitions := make([]Partition, 0, CountAllPartitions(degree))
+	arena := make([]int, 0, TotalParts(degree))
+	ForEachPartition(degree, func(p Partition) {
+		begin := len(arena)
+		arena = append(arena, p...)
+		partitions = append(partitions, arena[begin:len(arena):len(arena)])
+	})
 	return partitions
 }
 
+// CountAllPartitions returns p(degree) as an int.  see PartitionNumber
+// for degrees past maxRankableDegree, where it no longer fits.
 func CountAllPartitions(degree int) int {
-	var yield chan Partition = YieldAllPartitions(degree)
-	i := 0
-	for range yield {
-		i++
+	if degree > maxRankableDegree {
+		panic(fmt.Sprintf("partition count overflows int; degree=%d p=%v", degree, PartitionNumber(degree)))
 	}
-	return i
+	return RankerFor(degree).Count(degree)
 }
 
 // based on ruleAsc by jerome kelleher
 //   http://homepages.ed.ac.uk/jkellehe/partitions.php
 func ruleAsc(n int, yield chan Partition) {
-	debug := false
-	animate := false
-	var a []int = make([]int, n+1) // xxx +1 not needed here?
-	var k int = 1
-	a[0] = 0
-	a[1] = n
-	for k != 0 {
-		x := a[k-1] + 1
-		y := a[k] - 1
-		k -= 1
-		for x <= y {
-			a[k] = x
-			y -= x
-			k += 1
-		}
-		a[k] = x + y
-		var b []int = make([]int, k+1)
-		copy(b, a[:k+1])
+	ForEachPartition(n, func(a Partition) {
+		var b []int = make([]int, len(a))
+		copy(b, a)
 		yield <- b
-		if debug {
-			fmt.Printf("k=%d x=%d y=%d a=%v b=%v\n", k, x, y, a, b)
-		} else if animate {
-			fmt.Printf("\033[2Ka=%v\r", a)
-			time.Sleep(100*time.Millisecond)
-		}
+	})
+}
+
+// PartitionIterator steps through the partitions of n in ruleAsc
+// order:
+//
+//   for it := NewPartitionIterator(n, buf); it.Next(); {
+//     p := it.Partition()
+//     ...
+//   }
+//
+// the partition is only valid until the next call to Next, which
+// overwrites it in place.
+type PartitionIterator struct {
+	a []int
+	k int
+	p Partition
+}
+
+// NewPartitionIterator returns an iterator over the partitions of n
+// that works in buf, which is allocated if it has room for fewer than
+// n+1 ints.
+func NewPartitionIterator(n int, buf []int) *PartitionIterator {
+	return newPartitionIteratorAtLeast(n, 1, buf)
+}
+
+// newPartitionIteratorAtLeast iterates over the partitions of n with
+// every part at least k, of which there must be at least one.  each
+// step redistributes a[k-1] + a[k] with the first part above a[k-1],
+// so the first step is primed with a[0] = k-1 and a[1] = n-k+1.
+func newPartitionIteratorAtLeast(n, k int, buf []int) *PartitionIterator {
+	if cap(buf) < n+1 {
+		buf = make([]int, n+1)
+	}
+	a := buf[:n+1]
+	a[0] = k - 1
+	a[1] = n - (k - 1)
+	return &PartitionIterator{a: a, k: 1}
+}
+
+// Next advances to the next partition, returning false when there are
+// no more.
+func (it *PartitionIterator) Next() bool {
+	if it.k == 0 {
+		it.p = nil
+		return false
+	}
+	a := it.a
+	k := it.k
+	x := a[k-1] + 1
+	y := a[k] - 1
+	k -= 1
+	for x <= y {
+		a[k] = x
+		y -= x
+		k += 1
+	}
+	a[k] = x + y
+	it.k = k
+	it.p = a[:k+1]
+	return true
+}
+
+func (it *PartitionIterator) Partition() Partition {
+	return it.p
+}
+
+// ForEachPartition calls visit with each partition of n in ruleAsc
+// order.  the partition passed to visit is only valid during the
+// call; it is overwritten by the next one.
+func ForEachPartition(n int, visit func(Partition)) {
+	for it := NewPartitionIterator(n, nil); it.Next(); {
+		visit(it.Partition())
 	}
 }
 
@@ -0,0 +1,110 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"fmt"
+	"math/big"
+	"sync"
+)
+
+// exact partition counts in big.Int, without enumerating anything.
+//
+// euler's pentagonal number theorem gives
+//
+//   p(n) = sum_{k >= 1} (-1)^(k+1) (p(n - k(3k-1)/2) + p(n - k(3k+1)/2))
+//
+// with p(0) = 1 and p(m) = 0 for m < 0, so p(0..n) takes O(n^1.5)
+// additions.
+
+var partitionNumbers struct {
+	sync.Mutex
+	p []*big.Int
+}
+
+// PartitionNumbers returns p(0), ..., p(n).  the values are shared and
+// must not be modified.
+func PartitionNumbers(n int) []*big.Int {
+	partitionNumbers.Lock()
+	defer partitionNumbers.Unlock()
+	p := partitionNumbers.p
+	if len(p) == 0 {
+		p = append(p, big.NewInt(1))
+	}
+	for m := len(p); m <= n; m++ {
+		z := big.NewInt(0)
+		for k := 1; ; k++ {
+			g1 := k * (3*k - 1) / 2
+			if g1 > m {
+				break
+			}
+			g2 := g1 + k // k(3k+1)/2
+			if k%2 == 1 {
+				z.Add(z, p[m-g1])
+				if g2 <= m {
+					z.Add(z, p[m-g2])
+				}
+			} else {
+				z.Sub(z, p[m-g1])
+				if g2 <= m {
+					z.Sub(z, p[m-g2])
+				}
+			}
+		}
+		p = append(p, z)
+	}
+	partitionNumbers.p = p
+	return p[:n+1]
+}
+
+// PartitionNumber returns p(n), the number of partitions of n.
+func PartitionNumber(n int) *big.Int {
+	if n < 0 {
+		return big.NewInt(0)
+	}
+	return new(big.Int).Set(PartitionNumbers(n)[n])
+}
+
+// PartitionNumberAtLeast returns the number of partitions of n with
+// every part at least k, P(n, k) of rank.go, without the int limit.
+// P(n, 2) = p(n) - p(n-1) counts the partitions without 1s.
+func PartitionNumberAtLeast(n, k int) *big.Int {
+	if n < 0 || k < 1 {
+		panic(fmt.Sprintf("bad restricted partition count; n=%d k=%d", n, k))
+	}
+	if k == 1 {
+		return PartitionNumber(n)
+	}
+	if k > n {
+		if n == 0 {
+			return big.NewInt(1)
+		}
+		return big.NewInt(0)
+	}
+	// P(r, j) = P(r, j+1) + P(r-j, j), for j from n down to k.  only
+	// rows r <= n and columns j >= k are needed; row[r] holds P(r, j)
+	// for the current j.
+	row := make([]*big.Int, n+1)
+	for r := range row {
+		row[r] = big.NewInt(0)
+	}
+	row[0].SetInt64(1)
+	for j := n; j >= k; j-- {
+		for r := j; r <= n; r++ {
+			row[r].Add(row[r], row[r-j])
+		}
+	}
+	return row[n]
+}
+
+// TotalPartsBig is TotalParts without the int limit.
+func TotalPartsBig(n int) *big.Int {
+	p := PartitionNumbers(n)
+	total := big.NewInt(0)
+	z := big.NewInt(0)
+	for k := 1; k <= n; k++ {
+		z.SetInt64(int64(Factor(k).NumDivisors()))
+		total.Add(total, z.Mul(z, p[n-k]))
+	}
+	return total
+}
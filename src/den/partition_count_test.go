@@ -0,0 +1,70 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestPartitionNumberMatchesRanker(t *testing.T) {
+	ranker := RankerFor(maxRankableDegree)
+	p := PartitionNumbers(maxRankableDegree)
+	for n := 0; n <= maxRankableDegree; n++ {
+		if !p[n].IsInt64() || p[n].Int64() != int64(ranker.Count(n)) {
+			t.Errorf("p(n) mismatch; n=%d ranker=%d pentagonal=%v", n, ranker.Count(n), p[n])
+		}
+	}
+}
+
+func TestPartitionNumberKnownValues(t *testing.T) {
+	// http://oeis.org/A000041/b000041.txt
+	type tcase struct {
+		n int
+		p string
+	}
+	tcases := []tcase{
+		tcase{0, "1"},
+		tcase{1, "1"},
+		tcase{100, "190569292"},
+		tcase{500, "2300165032574323995027"},
+		tcase{1000, "24061467864032622473692149727991"},
+	}
+	for _, c := range tcases {
+		if got := PartitionNumber(c.n).String(); got != c.p {
+			t.Errorf("p(%d) expected=%s got=%s", c.n, c.p, got)
+		}
+	}
+	if PartitionNumber(-1).Sign() != 0 {
+		t.Errorf("expected p(-1)=0")
+	}
+}
+
+func TestPartitionNumberAtLeast(t *testing.T) {
+	N := 60
+	ranker := RankerFor(N)
+	for n := 0; n <= N; n++ {
+		for k := 1; k <= N+1; k++ {
+			expected := ranker.atLeast[n][k]
+			if got := PartitionNumberAtLeast(n, k); !got.IsInt64() || got.Int64() != int64(expected) {
+				t.Errorf("P(n, k) mismatch; n=%d k=%d expected=%d got=%v", n, k, expected, got)
+			}
+		}
+	}
+	// partitions without 1s
+	for n := 1; n <= N; n++ {
+		z := PartitionNumber(n)
+		z.Sub(z, PartitionNumber(n-1))
+		if PartitionNumberAtLeast(n, 2).Cmp(z) != 0 {
+			t.Errorf("P(n, 2) != p(n) - p(n-1); n=%d", n)
+		}
+	}
+}
+
+func TestTotalPartsBig(t *testing.T) {
+	for n := 1; n <= 100; n++ {
+		if TotalPartsBig(n).Cmp(big.NewInt(int64(TotalParts(n)))) != 0 {
+			t.Errorf("total parts mismatch; n=%d expected=%d got=%v", n, TotalParts(n), TotalPartsBig(n))
+		}
+	}
+}
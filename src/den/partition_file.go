@@ -0,0 +1,240 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// partition files hold a PartitionStore on disk, so that degrees whose
+// partitions do not fit in memory can be mapped instead.  all integers
+// are little endian.
+//
+//   offset  size  field
+//        0     8  magic "DENPARTS"
+//        8     4  version
+//       12     4  degree n
+//       16     8  count, p(n)
+//       24     8  arena bytes, TotalParts(n)
+//       32     8  index offset, 8 byte aligned
+//       40     8  crc64 (ecma) of the arena
+//       48     8  crc64 (ecma) of the index
+//       56     4  crc32 (ieee) of bytes 0..55
+//       60     4  reserved, zero
+//       64        arena: the parts of each partition in ruleAsc order,
+//                 one byte per part
+//                 padding to the index offset
+//  index          count+1 uint64 offsets into the arena
+//
+// the counts are known from n before anything is generated, so the
+// arena and index are written in one pass, each at its own offset.
+
+const PartitionFileVersion = 1
+
+const partitionFileMagic = "DENPARTS"
+const partitionFileHeaderSize = 64
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+type partitionFileHeader struct {
+	version uint32
+	degree uint32
+	count uint64
+	arenaBytes uint64
+	indexOffset uint64
+	arenaSum uint64
+	indexSum uint64
+}
+
+func (h *partitionFileHeader) encode() []byte {
+	b := make([]byte, partitionFileHeaderSize)
+	copy(b, partitionFileMagic)
+	binary.LittleEndian.PutUint32(b[8:], h.version)
+	binary.LittleEndian.PutUint32(b[12:], h.degree)
+	binary.LittleEndian.PutUint64(b[16:], h.count)
+	binary.LittleEndian.PutUint64(b[24:], h.arenaBytes)
+	binary.LittleEndian.PutUint64(b[32:], h.indexOffset)
+	binary.LittleEndian.PutUint64(b[40:], h.arenaSum)
+	binary.LittleEndian.PutUint64(b[48:], h.indexSum)
+	binary.LittleEndian.PutUint32(b[56:], crc32.ChecksumIEEE(b[:56]))
+	return b
+}
+
+func decodePartitionFileHeader(b []byte) (*partitionFileHeader, error) {
+	if len(b) < partitionFileHeaderSize || string(b[:8]) != partitionFileMagic {
+		return nil, fmt.Errorf("not a partition file")
+	}
+	if crc32.ChecksumIEEE(b[:56]) != binary.LittleEndian.Uint32(b[56:]) {
+		return nil, fmt.Errorf("partition file header checksum mismatch")
+	}
+	h := &partitionFileHeader{
+		version: binary.LittleEndian.Uint32(b[8:]),
+		degree: binary.LittleEndian.Uint32(b[12:]),
+		count: binary.LittleEndian.Uint64(b[16:]),
+		arenaBytes: binary.LittleEndian.Uint64(b[24:]),
+		indexOffset: binary.LittleEndian.Uint64(b[32:]),
+		arenaSum: binary.LittleEndian.Uint64(b[40:]),
+		indexSum: binary.LittleEndian.Uint64(b[48:]),
+	}
+	if h.version != PartitionFileVersion {
+		return nil, fmt.Errorf("unsupported partition file version; version=%d supported=%d",
+			h.version, PartitionFileVersion)
+	}
+	return h, nil
+}
+
+func partitionFileLayout(degree int) *partitionFileHeader {
+	count := uint64(RankerFor(degree).Count(degree))
+	arenaBytes := uint64(TotalParts(degree))
+	return &partitionFileHeader{
+		version: PartitionFileVersion,
+		degree: uint32(degree),
+		count: count,
+		arenaBytes: arenaBytes,
+		indexOffset: (partitionFileHeaderSize + arenaBytes + 7) &^ 7,
+	}
+}
+
+// PartitionFilePath is the conventional name of the partition file of
+// degree n in dir.
+func PartitionFilePath(dir string, n int) string {
+	return filepath.Join(dir, fmt.Sprintf("partitions-%d.den", n))
+}
+
+// WritePartitionFile writes the partitions of degree to path.  the file
+// is written under a temporary name and renamed into place, so a
+// crashed write never leaves a file that looks complete.
+func WritePartitionFile(path string, degree int) (err error) {
+	if degree < 1 || degree > MaxPartitionStoreDegree {
+		return fmt.Errorf("degree out of range for partition file; degree=%d max=%d",
+			degree, MaxPartitionStoreDegree)
+	}
+	h := partitionFileLayout(degree)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+	if err = f.Truncate(int64(h.indexOffset + 8*(h.count+1))); err != nil {
+		return err
+	}
+	arenaSum := crc64.New(crc64Table)
+	indexSum := crc64.New(crc64Table)
+	arena := bufio.NewWriterSize(io.MultiWriter(
+		io.NewOffsetWriter(f, partitionFileHeaderSize), arenaSum), 1<<20)
+	index := bufio.NewWriterSize(io.MultiWriter(
+		io.NewOffsetWriter(f, int64(h.indexOffset)), indexSum), 1<<20)
+	var word [8]byte
+	var offset uint64
+	writeOffset := func() {
+		binary.LittleEndian.PutUint64(word[:], offset)
+		index.Write(word[:])
+	}
+	writeOffset()
+	for it := NewPartitionIterator(degree, nil); it.Next(); {
+		for _, x := range it.Partition() {
+			arena.WriteByte(byte(x))
+		}
+		offset += uint64(len(it.Partition()))
+		writeOffset()
+	}
+	if err = arena.Flush(); err != nil {
+		return err
+	}
+	if err = index.Flush(); err != nil {
+		return err
+	}
+	if offset != h.arenaBytes {
+		return fmt.Errorf("partition arena size mismatch; expected=%d got=%d", h.arenaBytes, offset)
+	}
+	h.arenaSum = arenaSum.Sum64()
+	h.indexSum = indexSum.Sum64()
+	if _, err = f.WriteAt(h.encode(), 0); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// OpenPartitionFile maps the partition file at path, which must hold
+// the partitions of degree.  the header, the sizes implied by degree
+// and the checksums of the arena and index are all checked, so a file
+// of the wrong degree, truncated or corrupted is refused.
+func OpenPartitionFile(path string, degree int) (*PartitionStore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() < partitionFileHeaderSize {
+		return nil, fmt.Errorf("partition file too short; path=%s size=%d", path, fi.Size())
+	}
+	data, err := mapFile(f, int(fi.Size()))
+	if err != nil {
+		return nil, err
+	}
+	store, err := openPartitionData(data, degree)
+	if err != nil {
+		unmapFile(data)
+		return nil, fmt.Errorf("%v; path=%s", err, path)
+	}
+	return store, nil
+}
+
+func openPartitionData(data []byte, degree int) (*PartitionStore, error) {
+	h, err := decodePartitionFileHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if int(h.degree) != degree {
+		return nil, fmt.Errorf("partition file has wrong degree; expected=%d got=%d", degree, h.degree)
+	}
+	if degree < 1 || degree > MaxPartitionStoreDegree {
+		return nil, fmt.Errorf("degree out of range for partition file; degree=%d", degree)
+	}
+	expected := partitionFileLayout(degree)
+	if h.count != expected.count || h.arenaBytes != expected.arenaBytes || h.indexOffset != expected.indexOffset {
+		return nil, fmt.Errorf("partition file layout does not match degree; degree=%d count=%d arena=%d index=%d",
+			degree, h.count, h.arenaBytes, h.indexOffset)
+	}
+	end := h.indexOffset + 8*(h.count+1)
+	if uint64(len(data)) != end {
+		return nil, fmt.Errorf("partition file size mismatch; expected=%d got=%d", end, len(data))
+	}
+	arena := data[partitionFileHeaderSize : partitionFileHeaderSize+h.arenaBytes]
+	index := data[h.indexOffset:end]
+	if crc64.Checksum(arena, crc64Table) != h.arenaSum {
+		return nil, fmt.Errorf("partition file arena checksum mismatch")
+	}
+	if crc64.Checksum(index, crc64Table) != h.indexSum {
+		return nil, fmt.Errorf("partition file index checksum mismatch")
+	}
+	return &PartitionStore{
+		degree: degree,
+		arena: arena,
+		index: index,
+		mapping: data,
+	}, nil
+}
@@ -0,0 +1,25 @@
+// Copyright 2018 Adam Marks
+
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package den
+
+import (
+	"io"
+	"os"
+)
+
+// without mmap the file is read into memory, so the memory budget is
+// not kept.
+func mapFile(f *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(f, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func unmapFile(data []byte) error {
+	return nil
+}
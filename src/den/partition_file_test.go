@@ -0,0 +1,138 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPartitionFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	maxDegree := 40
+	if testing.Short() {
+		maxDegree = 25
+	}
+	for d := 1; d <= maxDegree; d++ {
+		path := PartitionFilePath(dir, d)
+		if err := WritePartitionFile(path, d); err != nil {
+			t.Fatalf("write d=%d: %v", d, err)
+		}
+		store, err := OpenPartitionFile(path, d)
+		if err != nil {
+			t.Fatalf("open d=%d: %v", d, err)
+		}
+		memory, err := NewPartitionStore(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !store.Mapped() || store.Len() != memory.Len() || store.SizeBytes() != memory.SizeBytes() {
+			t.Errorf("store mismatch; d=%d len=%d/%d bytes=%d/%d", d,
+				store.Len(), memory.Len(), store.SizeBytes(), memory.SizeBytes())
+		}
+		for i := 0; i < memory.Len(); i++ {
+			if string(store.At(i)) != string(memory.At(i)) {
+				t.Errorf("partition mismatch; d=%d i=%d expected=%v got=%v", d, i, memory.At(i), store.At(i))
+				break
+			}
+		}
+		if err := store.Close(); err != nil {
+			t.Errorf("close d=%d: %v", d, err)
+		}
+	}
+}
+
+func TestPartitionFileRejectsBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	d := 12
+	path := PartitionFilePath(dir, d)
+	if err := WritePartitionFile(path, d); err != nil {
+		t.Fatal(err)
+	}
+	good, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := partitionFileLayout(d)
+	type tcase struct {
+		name string
+		degree int
+		corrupt func(b []byte) []byte
+		expected string
+	}
+	tcases := []tcase{
+		tcase{"wrong degree", d + 1, nil, "wrong degree"},
+		tcase{"magic", d, func(b []byte) []byte { b[0] = 'X'; return b }, "not a partition file"},
+		tcase{"header", d, func(b []byte) []byte { b[20]++; return b }, "header checksum"},
+		tcase{"arena", d, func(b []byte) []byte { b[partitionFileHeaderSize+5] ^= 1; return b }, "arena checksum"},
+		tcase{"index", d, func(b []byte) []byte { b[h.indexOffset+8] ^= 1; return b }, "index checksum"},
+		tcase{"truncated", d, func(b []byte) []byte { return b[:len(b)-8] }, "size mismatch"},
+		tcase{"short", d, func(b []byte) []byte { return b[:10] }, "too short"},
+	}
+	for _, c := range tcases {
+		b := append([]byte(nil), good...)
+		if c.corrupt != nil {
+			b = c.corrupt(b)
+		}
+		bad := PartitionFilePath(dir, 1000)
+		if err := os.WriteFile(bad, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		store, err := OpenPartitionFile(bad, c.degree)
+		if err == nil {
+			store.Close()
+			t.Errorf("%s: expected error", c.name)
+		} else if !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("%s: expected error containing %q got=%v", c.name, c.expected, err)
+		}
+	}
+}
+
+func TestExpanderV3FromPartitionFile(t *testing.T) {
+	dir := t.TempDir()
+	d := 30
+	if testing.Short() {
+		d = 22
+	}
+	path := PartitionFilePath(dir, d)
+	if err := WritePartitionFile(path, d); err != nil {
+		t.Fatal(err)
+	}
+	exp, err := NewExpanderV3(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.SetPartitionFile(path)
+	plan, err := NewResourcePlan("ExpanderV3", d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// room for the marks only
+	exp.SetMemoryBudget(plan.MarkBytes.Int64())
+	expected, err := NewExpanderV3(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp.Width().Cmp(expected.Width()) != 0 {
+		t.Errorf("width from file mismatch; d=%d", d)
+	}
+	store := exp.Partitions()
+	if !store.Mapped() {
+		t.Errorf("expected mapped partitions")
+	}
+	if err := exp.Close(); err != nil || store.Mapped() {
+		t.Errorf("expected the mapping released; err=%v", err)
+	}
+}
+
+func TestExpanderV3MemoryBudget(t *testing.T) {
+	exp, err := NewExpanderV3(30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.SetMemoryBudget(1024)
+	if err := exp.Expand(); err == nil || !strings.Contains(err.Error(), "memory budget") {
+		t.Errorf("expected memory budget error; got=%v", err)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+// splitting the ruleAsc sequence into independent ranges.  the
+// partitions of n that begin with a fixed prefix a_1 <= ... <= a_j
+// form a contiguous run of the sequence: they are the prefix followed
+// by each partition of r = n - (a_1 + ... + a_j) with every part at
+// least a_j, in ruleAsc order.  the run for prefix a_1..a_j splits in
+// turn into the runs for a_1..a_j x, for x = a_j, a_j+1, ..., in
+// order, so any set of prefixes obtained by repeated splitting covers
+// the sequence exactly, and their starting indices follow from the
+// counts P(r, k) of the ranker.
+
+// partitionRange is the run of partitions of n that begin with prefix.
+type partitionRange struct {
+	prefix []int
+	remainder int // n minus the sum of the prefix
+	minPart int   // the last part of the prefix, or 1 if it is empty
+	index int     // ruleAsc index of the first partition of the run
+	count int     // number of partitions in the run
+	partIndex int // offset of the first part in a packed arena
+	numParts int  // total parts over the run, including the prefixes
+}
+
+// partsTable returns T with T[r][k] the total number of parts over
+// the partitions of r with every part at least k, for r <= n and
+// k <= n+1.  it follows the recurrence for P(r, k): a partition either
+// has no part equal to k, or is k followed by a partition of r-k with
+// parts at least k, which has one more part.
+func partsTable(ranker *PartitionRanker, n int) [][]int {
+	T := make([][]int, n+1)
+	for r := 0; r <= n; r++ {
+		T[r] = make([]int, n+2)
+		for k := n; k >= 1; k-- {
+			x := T[r][k+1]
+			if k <= r {
+				x += ranker.atLeast[r-k][k] + T[r-k][k]
+			}
+			T[r][k] = x
+		}
+	}
+	return T
+}
+
+// splitPartitions splits the partitions of n into ranges of at most
+// limit partitions where possible, in ruleAsc order.
+func splitPartitions(n, limit int) []partitionRange {
+	ranker := RankerFor(n)
+	T := partsTable(ranker, n)
+	root := partitionRange{
+		remainder: n,
+		minPart: 1,
+		count: ranker.Count(n),
+		numParts: T[n][1],
+	}
+	var ranges []partitionRange
+	var split func(pr partitionRange)
+	split = func(pr partitionRange) {
+		if pr.count <= limit || pr.remainder == 0 {
+			ranges = append(ranges, pr)
+			return
+		}
+		index, partIndex := pr.index, pr.partIndex
+		for x := pr.minPart; x <= pr.remainder; x++ {
+			r := pr.remainder - x
+			count := ranker.atLeast[r][x]
+			if count == 0 {
+				continue
+			}
+			prefix := make([]int, len(pr.prefix)+1)
+			copy(prefix, pr.prefix)
+			prefix[len(pr.prefix)] = x
+			child := partitionRange{
+				prefix: prefix,
+				remainder: r,
+				minPart: x,
+				index: index,
+				count: count,
+				partIndex: partIndex,
+				numParts: count*len(prefix) + T[r][x],
+			}
+			index += count
+			partIndex += child.numParts
+			split(child)
+		}
+	}
+	split(root)
+	return ranges
+}
+
+// forEach calls visit with each partition of the range in turn, built
+// in buf, which must have room for n+1 ints.
+func (pr partitionRange) forEach(buf []int, visit func(Partition)) {
+	j := copy(buf, pr.prefix)
+	if pr.remainder == 0 {
+		visit(buf[:j])
+		return
+	}
+	it := newPartitionIteratorAtLeast(pr.remainder, pr.minPart, buf[j:])
+	for it.Next() {
+		visit(buf[:j+len(it.Partition())])
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"testing"
+)
+
+func TestSplitPartitionsReproducesRuleAsc(t *testing.T) {
+	maxDegree := 30
+	if testing.Short() {
+		maxDegree = 22
+	}
+	for d := 1; d <= maxDegree; d++ {
+		all := AllPartitions(d)
+		for _, limit := range []int{1, 2, 5, 100} {
+			ranges := splitPartitions(d, limit)
+			i, parts := 0, 0
+			buf := make([]int, d+1)
+			for _, pr := range ranges {
+				if pr.index != i || pr.partIndex != parts {
+					t.Errorf("range start; d=%d limit=%d prefix=%v index=%d/%d parts=%d/%d",
+						d, limit, pr.prefix, pr.index, i, pr.partIndex, parts)
+				}
+				n := 0
+				pr.forEach(buf, func(p Partition) {
+					if i < len(all) && !p.Equal(all[i]) {
+						t.Errorf("partition mismatch; d=%d limit=%d i=%d expected=%v got=%v",
+							d, limit, i, all[i], p)
+					}
+					i++
+					n++
+					parts += len(p)
+				})
+				if n != pr.count {
+					t.Errorf("range count; d=%d limit=%d prefix=%v expected=%d got=%d",
+						d, limit, pr.prefix, pr.count, n)
+				}
+				if pr.count > limit && pr.remainder > 0 {
+					t.Errorf("range not split; d=%d limit=%d prefix=%v count=%d", d, limit, pr.prefix, pr.count)
+				}
+			}
+			if i != len(all) || parts != TotalParts(d) {
+				t.Errorf("coverage; d=%d limit=%d partitions=%d/%d parts=%d/%d",
+					d, limit, i, len(all), parts, TotalParts(d))
+			}
+		}
+	}
+}
+
+func TestPartitionIteratorAtLeast(t *testing.T) {
+	ranker := RankerFor(20)
+	for n := 1; n <= 20; n++ {
+		for k := 1; k <= n; k++ {
+			count := 0
+			for it := newPartitionIteratorAtLeast(n, k, nil); it.Next(); {
+				p := it.Partition()
+				if p.Sum() != n || p[0] < k {
+					t.Errorf("bad partition; n=%d k=%d p=%v", n, k, p)
+				}
+				count++
+			}
+			if count != ranker.atLeast[n][k] {
+				t.Errorf("count; n=%d k=%d expected=%d got=%d", n, k, ranker.atLeast[n][k], count)
+			}
+		}
+	}
+}
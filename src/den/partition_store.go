@@ -0,0 +1,224 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// parts of stored partitions are bytes, which covers degrees up to 255.
+type PartitionInt = uint8
+
+const MaxPartitionStoreDegree = 255
+
+// PackedPartition is a partition with byte-sized parts, typically a
+// view into the arena of a PartitionStore.
+type PackedPartition []PartitionInt
+
+func (p PackedPartition) Sum() int {
+	var sum int
+	for _, x := range p {
+		sum += int(x)
+	}
+	return sum
+}
+
+func (p PackedPartition) CycleType(t CycleType) {
+	for i := range t {
+		t[i] = 0
+	}
+	for _, x := range p {
+		t[x-1]++
+	}
+}
+
+// Unpack copies the parts into buf, which must have room for them.
+func (p PackedPartition) Unpack(buf []int) Partition {
+	for i, x := range p {
+		buf[i] = int(x)
+	}
+	return buf[:len(p)]
+}
+
+func (p PackedPartition) String() string {
+	return p.Unpack(make([]int, len(p))).String()
+}
+
+// PartitionStore holds all partitions of n in ruleAsc order, packed
+// end to end in a single byte arena.  partition i occupies
+// arena[offsets[i]:offsets[i+1]].  a store opened from a partition
+// file (see partition_file.go) instead maps the arena and keeps the
+// offsets as little endian words in index.
+type PartitionStore struct {
+	degree int
+	arena []PartitionInt
+	offsets []uint64
+	index []byte
+	mapping []byte
+}
+
+func NewPartitionStore(degree int) (*PartitionStore, error) {
+	return NewPartitionStoreWithWorkers(degree, runtime.NumCPU())
+}
+
+// NewPartitionStoreWithWorkers generates the store with k workers.  the
+// ruleAsc sequence is split into ranges by prefix (see
+// partition_range.go), and each worker writes whole ranges straight
+// into their place in the arena, so the order and indices are those
+// of a serial ruleAsc.
+func NewPartitionStoreWithWorkers(degree, k int) (*PartitionStore, error) {
+	if err := checkDegree("partition store", degree, MaxPartitionStoreDegree); err != nil {
+		return nil, err
+	}
+	if k < 1 {
+		k = 1
+	}
+	count := RankerFor(degree).Count(degree)
+	store := &PartitionStore{
+		degree: degree,
+		arena: make([]PartitionInt, TotalParts(degree)),
+		offsets: make([]uint64, count+1),
+	}
+	limit := count / (k * partitionRangesPerWorker)
+	if limit < minPartitionRange {
+		limit = minPartitionRange
+	}
+	ranges := splitPartitions(degree, limit)
+	jobs := make(chan partitionRange, len(ranges))
+	for _, pr := range ranges {
+		jobs <- pr
+	}
+	close(jobs)
+	var wg sync.WaitGroup
+	for w := 0; w < k; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]int, degree+1)
+			for pr := range jobs {
+				store.fill(pr, buf)
+			}
+		}()
+	}
+	wg.Wait()
+	return store, nil
+}
+
+// ranges are made small enough to balance the workers, but not so
+// small that the prefixes dominate.
+const partitionRangesPerWorker = 16
+const minPartitionRange = 4096
+
+func (store *PartitionStore) fill(pr partitionRange, buf []int) {
+	i, j := pr.index, pr.partIndex
+	pr.forEach(buf, func(p Partition) {
+		for _, x := range p {
+			store.arena[j] = PartitionInt(x)
+			j++
+		}
+		i++
+		store.offsets[i] = uint64(j)
+	})
+	if i != pr.index+pr.count || j != pr.partIndex+pr.numParts {
+		panic(fmt.Sprintf("partition range overran; prefix=%v index=%d count=%d got=%d parts=%d got=%d",
+			pr.prefix, pr.index, pr.count, i-pr.index, pr.numParts, j-pr.partIndex))
+	}
+}
+
+// Extend returns the store of the next degree, reusing this one for
+// the partitions that contain a 1, which come first: 1 followed by
+// each partition of n in order.  only the partitions of n+1 without 1s
+// are generated.
+func (store *PartitionStore) Extend() (*PartitionStore, error) {
+	n := store.degree + 1
+	if err := checkDegree("partition store", n, MaxPartitionStoreDegree); err != nil {
+		return nil, err
+	}
+	count := RankerFor(n).Count(n)
+	next := &PartitionStore{
+		degree: n,
+		arena: make([]PartitionInt, 0, TotalParts(n)),
+		offsets: make([]uint64, 1, count+1),
+	}
+	for i := 0; i < store.Len(); i++ {
+		next.arena = append(next.arena, 1)
+		next.arena = append(next.arena, store.At(i)...)
+		next.offsets = append(next.offsets, uint64(len(next.arena)))
+	}
+	for it := newPartitionIteratorAtLeast(n, 2, nil); it.Next(); {
+		for _, x := range it.Partition() {
+			next.arena = append(next.arena, PartitionInt(x))
+		}
+		next.offsets = append(next.offsets, uint64(len(next.arena)))
+	}
+	return next, nil
+}
+
+// TotalParts returns the total number of parts over all partitions of
+// n, which is sum_{k=1}^{n} d(k) p(n-k) where d counts divisors: each
+// part k of multiplicity at least j is counted once per pair (k, j).
+func TotalParts(n int) int {
+	ranker := RankerFor(n)
+	total := 0
+	for k := 1; k <= n; k++ {
+		total += Factor(k).NumDivisors() * ranker.Count(n-k)
+	}
+	return total
+}
+
+func (store *PartitionStore) Degree() int {
+	return store.degree
+}
+
+func (store *PartitionStore) Len() int {
+	if store.offsets == nil {
+		return len(store.index)/8 - 1
+	}
+	return len(store.offsets) - 1
+}
+
+func (store *PartitionStore) offset(i int) uint64 {
+	if store.offsets == nil {
+		return binary.LittleEndian.Uint64(store.index[8*i:])
+	}
+	return store.offsets[i]
+}
+
+// At returns a view of partition i; it shares the arena and must not
+// be modified.
+func (store *PartitionStore) At(i int) PackedPartition {
+	return store.arena[store.offset(i):store.offset(i+1)]
+}
+
+// PartitionAt unpacks partition i into buf, which must have room for
+// degree parts.
+func (store *PartitionStore) PartitionAt(i int, buf []int) Partition {
+	return store.At(i).Unpack(buf)
+}
+
+// SizeBytes returns the bytes held by the arena and the index.  for a
+// mapped store they are on disk, and resident only as paged in.
+func (store *PartitionStore) SizeBytes() int {
+	if store.offsets == nil {
+		return len(store.arena) + len(store.index)
+	}
+	return cap(store.arena) + 8*cap(store.offsets)
+}
+
+func (store *PartitionStore) Mapped() bool {
+	return store.mapping != nil
+}
+
+// Close releases the mapping of a store opened from a file.  the store
+// must not be used afterwards.  it does nothing for other stores.
+func (store *PartitionStore) Close() error {
+	if store.mapping == nil {
+		return nil
+	}
+	err := unmapFile(store.mapping)
+	store.mapping, store.arena, store.index = nil, nil, nil
+	return err
+}
@@ -0,0 +1,77 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPartitionStoreMatchesAllPartitions(t *testing.T) {
+	maxDegree := 50
+	if testing.Short() {
+		maxDegree = 35
+	}
+	for d := 1; d <= maxDegree; d++ {
+		store, err := NewPartitionStore(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		partitions := AllPartitions(d)
+		if store.Len() != len(partitions) {
+			t.Errorf("length mismatch; d=%d expected=%d got=%d", d, len(partitions), store.Len())
+		}
+		total := 0
+		buf := make([]int, d)
+		for i, p := range partitions {
+			total += len(p)
+			if q := store.PartitionAt(i, buf); !q.Equal(p) {
+				t.Errorf("partition mismatch; d=%d i=%d expected=%v got=%v", d, i, p, q)
+			}
+			if store.At(i).Sum() != d {
+				t.Errorf("bad sum; d=%d i=%d p=%v", d, i, store.At(i))
+			}
+		}
+		if total != TotalParts(d) || len(store.arena) != total || cap(store.arena) != total {
+			t.Errorf("arena size mismatch; d=%d parts=%d TotalParts=%d arena=%d/%d",
+				d, total, TotalParts(d), len(store.arena), cap(store.arena))
+		}
+	}
+}
+
+func TestPartitionStoreDegreeLimit(t *testing.T) {
+	for _, d := range []int{0, -1, MaxPartitionStoreDegree + 1} {
+		var e *DegreeError
+		if _, err := NewPartitionStore(d); !errors.As(err, &e) || e.Degree != d {
+			t.Errorf("d=%d expected a *DegreeError got %v", d, err)
+		}
+	}
+}
+
+func TestPartitionStoreIndependentOfWorkers(t *testing.T) {
+	maxDegree := 40
+	if testing.Short() {
+		maxDegree = 30
+	}
+	for d := 1; d <= maxDegree; d++ {
+		serial, err := NewPartitionStoreWithWorkers(d, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, k := range []int{2, 3, 8} {
+			store, err := NewPartitionStoreWithWorkers(d, k)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(store.arena) != string(serial.arena) {
+				t.Errorf("arena differs; d=%d workers=%d", d, k)
+			}
+			for i := range serial.offsets {
+				if store.offsets[i] != serial.offsets[i] {
+					t.Errorf("offset differs; d=%d workers=%d i=%d", d, k, i)
+					break
+				}
+			}
+		}
+	}
+}
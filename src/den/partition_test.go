@@ -248,3 +248,60 @@ func TestSortablePartitionsSearch(t *testing.T) {
 		}
 	}
 }
+
+func TestPartitionIteratorMatchesYield(t *testing.T) {
+	maxDegree := 40
+	if testing.Short() {
+		maxDegree = 25
+	}
+	buf := make([]int, maxDegree+1)
+	for d := 1; d <= maxDegree; d++ {
+		it := NewPartitionIterator(d, buf)
+		i := 0
+		for p := range YieldAllPartitions(d) {
+			if !it.Next() {
+				t.Errorf("iterator ended early; d=%d i=%d", d, i)
+				break
+			}
+			if !it.Partition().Equal(p) {
+				t.Errorf("iterator mismatch; d=%d i=%d expected=%v got=%v", d, i, p, it.Partition())
+			}
+			i++
+		}
+		if it.Next() {
+			t.Errorf("iterator did not end; d=%d got=%v", d, it.Partition())
+		}
+		if n := CountAllPartitions(d); n != i {
+			t.Errorf("count mismatch; d=%d expected=%d got=%d", d, i, n)
+		}
+	}
+}
+
+func TestPartitionIteratorReusesBuffer(t *testing.T) {
+	d := 20
+	buf := make([]int, d+1)
+	allocs := testing.AllocsPerRun(10, func() {
+		for it := NewPartitionIterator(d, buf); it.Next(); {
+			if &it.Partition()[0] != &buf[0] {
+				t.Fatalf("partition not in caller buffer")
+			}
+		}
+	})
+	// the iterator itself
+	if allocs > 1 {
+		t.Errorf("expected at most one allocation per pass; got=%v", allocs)
+	}
+}
+
+func TestAllPartitionsAreIndependent(t *testing.T) {
+	d := 8
+	P := AllPartitions(d)
+	Q := AllPartitions(d)
+	P[0] = append(P[0], 99)
+	P[1][0] = 99
+	for i := 2; i < len(P); i++ {
+		if !P[i].Equal(Q[i]) {
+			t.Errorf("partition changed; i=%d expected=%v got=%v", i, Q[i], P[i])
+		}
+	}
+}
@@ -4,6 +4,7 @@ package den
 
 import (
 	"fmt"
+	"io"
 )
 
 // partition fold table (PFT) xxx factor out / merge into
@@ -16,19 +17,30 @@ type PFT struct {
 	data []CycleType
 }
 
-func NewPFT(degree int, lambda CycleType) *PFT {
+// NewPFT returns the table of lambda, a cycle type of degree.
+func NewPFT(degree int, lambda CycleType) (*PFT, error) {
+	if err := checkDegree("PFT", degree, 0); err != nil {
+		return nil, err
+	}
+	if err := checkCycleType(lambda, degree); err != nil {
+		return nil, err
+	}
 
 	var X *PFT = new(PFT)
 
 	X.degree = degree
 	X.lambda = lambda.Pad(degree)
 
-	return X
+	return X, nil
 }
 
+// Generate fails if the order of lambda does not fit an int.
 // xxx factor out CycleType.Power
-func (X *PFT) Generate() {
-	order := X.lambda.Order()
+func (X *PFT) Generate() error {
+	order, err := X.lambda.Order()
+	if err != nil {
+		return err
+	}
 	//fmt.Printf("generating PFT degree=%v lambda=%v order=%v\n", X.degree, X.lambda, order)
 	X.data = make([]CycleType, order)
 	// note annoying conversion from mathematical 1-based notation
@@ -55,6 +67,7 @@ func (X *PFT) Generate() {
 			}
 		}
 	}
+	return nil
 }
 
 func (X *PFT) Power(k int) *CycleType {
@@ -67,38 +80,42 @@ func (X *PFT) Power(k int) *CycleType {
 // }
 
 func (X *PFT) String() string {
-	var s string
+	return renderString(X.WriteTo)
+}
+
+func (X *PFT) WriteTo(w io.Writer) (int64, error) {
+	r := newRenderer(w)
 	// header
-	s += "         "
+	r.print("         ")
 	for b := 0; b < X.degree; b++ {
-		s += fmt.Sprintf("%2d  ", b+1)
+		r.printf("%2d  ", b+1)
 	}
-	s += "\n"
-	s += "      +--"
+	r.print("\n")
+	r.print("      +--")
 	for b := 0; b < X.degree; b++ {
-		s += "----"
+		r.print("----")
 	}
-	s += "\n"
+	r.print("\n")
 	for a, _ := range X.data {
 		for b, z := range X.data[a] {
 			if b == 0 {
 				// sider
-				s += fmt.Sprintf("%6d|  ", a+1)
+				r.printf("%6d|  ", a+1)
 			} else {
-				s += "  "
+				r.print("  ")
 			}
 			if z > 0 {
-				s += fmt.Sprintf("%2d", z)
+				r.printf("%2d", z)
 			} else {
-				s += "  "
+				r.print("  ")
 			}
 		}
-		s += "\n"
+		r.print("\n")
 	}
-	return s
+	return r.done()
 }
 
-func (X *PFT) Check() {
+func (X *PFT) Check() error {
 	// verify that each row is a partition of the degree
 	for a, _ := range X.data {
 		var sum int
@@ -106,7 +123,8 @@ func (X *PFT) Check() {
 			sum += (b+1)*z
 		}
 		if sum != X.degree {
-			panic(fmt.Sprintf("bad partition; sum=%v row=%v %v", sum, a, X.data[a]))
+			return &CheckError{"PFT", X.degree, a, -1, fmt.Sprintf("bad partition; sum=%v %v", sum, X.data[a])}
 		}
 	}
+	return nil
 }
@@ -0,0 +1,147 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"math/big"
+	"math/rand"
+	"time"
+)
+
+// ResourcePlan predicts the size of a run of an engine at one degree
+// before it is started.  byte counts are for the data that grows with
+// p(n); fixed overheads are left out.
+type ResourcePlan struct {
+	Engine string
+	Degree int
+	Partitions *big.Int
+	PartitionBytes *big.Int // stored partitions or types
+	MarkBytes *big.Int      // mark table or markup
+	TableBytes *big.Int     // power table rows and index (CPT only)
+	// WorkUnits is the quantity the runtime is taken to scale with:
+	// partitions for ExpanderV3, row images for CPT.
+	WorkUnits *big.Int
+}
+
+var PlanEngines = []string{"CPT", "ExpanderV3"}
+
+func NewResourcePlan(engine string, degree int) (*ResourcePlan, error) {
+	var plan func(int) *ResourcePlan
+	max := 0
+	switch engine {
+	case "CPT":
+		plan = planCPT
+		max = MaxTypeDegree
+	case "ExpanderV3":
+		plan = planExpanderV3
+	default:
+		return nil, &UnknownEngineError{Engine: engine}
+	}
+	if err := checkDegree(engine, degree, max); err != nil {
+		return nil, err
+	}
+	return plan(degree), nil
+}
+
+// see PartitionStore and markTable.
+func planExpanderV3(n int) *ResourcePlan {
+	p := PartitionNumber(n)
+	plan := &ResourcePlan{
+		Engine: "ExpanderV3",
+		Degree: n,
+		Partitions: p,
+		PartitionBytes: TotalPartsBig(n),
+		MarkBytes: big.NewInt(63),
+		TableBytes: big.NewInt(0),
+		WorkUnits: p,
+	}
+	offsets := big.NewInt(1)
+	offsets.Add(offsets, p)
+	plan.PartitionBytes.Add(plan.PartitionBytes, offsets.Lsh(offsets, 3))
+	plan.MarkBytes.Add(plan.MarkBytes, p)
+	plan.MarkBytes.Rsh(plan.MarkBytes, 6)
+	plan.MarkBytes.Lsh(plan.MarkBytes, 3)
+	return plan
+}
+
+// the CPT holds one image per divisor of the order of each type, see
+// cptRow.  per type it also holds the type itself and its Type key in
+// cycleTypeMap, a byte per cycle plus map overhead, and a bool of
+// markup.
+func planCPT(n int) *ResourcePlan {
+	plan := &ResourcePlan{
+		Engine: "CPT",
+		Degree: n,
+		Partitions: PartitionNumber(n),
+		PartitionBytes: big.NewInt(0),
+		MarkBytes: big.NewInt(0),
+		TableBytes: big.NewInt(0),
+		WorkUnits: cptImages(n),
+	}
+	const sliceHeader = 24
+	const mapEntry = 48
+	const imageBytes = 24 // cptImage
+	keyBytes := int64(n + 24) // at most n cycles, plus degree and string header
+	z := big.NewInt(0)
+	numTypes := plan.Partitions
+	z.SetInt64(int64(8*n + sliceHeader) + keyBytes + mapEntry)
+	plan.PartitionBytes.Mul(numTypes, z)
+	plan.MarkBytes.Set(numTypes)
+	z.SetInt64(8 + sliceHeader) // cptRow
+	plan.TableBytes.Mul(numTypes, z)
+	z.SetInt64(imageBytes)
+	plan.TableBytes.Add(plan.TableBytes, z.Mul(z, plan.WorkUnits))
+	return plan
+}
+
+// the images of the CPT are counted type by type up to
+// cptPlanExactDegree.  beyond it, enumerating the p(n) types would be
+// the pass the plan is meant to let you skip, so the count is p(n)
+// times the mean number of divisors of the order over
+// cptPlanSamples types drawn uniformly by rank, with a seed fixed by
+// the degree so that the plan is the same every time.
+const cptPlanExactDegree = 40
+const cptPlanSamples = 4096
+
+func cptImages(n int) *big.Int {
+	images := big.NewInt(0)
+	z := big.NewInt(0)
+	var t CycleType = make([]int, n)
+	if n <= cptPlanExactDegree {
+		for it := NewPartitionIterator(n, nil); it.Next(); {
+			it.Partition().CycleType(t)
+			images.Add(images, z.SetInt64(int64(t.OrderFactorization().NumDivisors())))
+		}
+		return images
+	}
+	ranker := RankerFor(n) // MaxTypeDegree is within maxRankableDegree
+	rng := rand.New(rand.NewSource(int64(n)))
+	for i := 0; i < cptPlanSamples; i++ {
+		ranker.UnrankCycleType(n, int(rng.Int63n(int64(ranker.Count(n)))), t)
+		images.Add(images, z.SetInt64(int64(t.OrderFactorization().NumDivisors())))
+	}
+	images.Mul(images, PartitionNumber(n))
+	return images.Quo(images, z.SetInt64(cptPlanSamples))
+}
+
+func (plan *ResourcePlan) TotalBytes() *big.Int {
+	total := big.NewInt(0)
+	total.Add(plan.PartitionBytes, plan.MarkBytes)
+	return total.Add(total, plan.TableBytes)
+}
+
+// EstimateRuntime scales the work by a throughput in work units per
+// second, as measured at another degree.  the cost per unit grows
+// slowly with the degree, so estimates far from the measurement are
+// low.
+func (plan *ResourcePlan) EstimateRuntime(unitsPerSecond float64) time.Duration {
+	if unitsPerSecond <= 0 {
+		return 0
+	}
+	units, _ := new(big.Float).SetInt(plan.WorkUnits).Float64()
+	seconds := units / unitsPerSecond
+	if seconds > float64(1<<62)/float64(time.Second) {
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,206 @@
+// Copyright 2018 Adam Marks
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"den"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// plan predicts the partitions, memory and runtime of an engine over a
+// range of degrees before committing to a run.  throughput comes from
+// a recorded sequence file with a time column, such as
+// seq/WidthV3-DensityV3-WidthV3Time.txt, or else from a calibration
+// run at a small degree.
+func main() {
+	engine := "ExpanderV3"
+	begin := 0
+	end := 0
+	var degree int
+	var record string
+	var column string
+	var calibrate int
+	var memory string
+
+	flag.StringVar(&engine, "engine", engine, fmt.Sprintf("engine to plan: one of %v", den.PlanEngines))
+	flag.IntVar(&degree, "n", 40, "degree of symmetric group")
+	flag.IntVar(&begin, "b", begin, "begin degree (default n)")
+	flag.IntVar(&end, "e", end, "end degree (default n)")
+	flag.StringVar(&record, "record", "", "sequence file with recorded times in seconds")
+	flag.StringVar(&column, "column", "", "time column in the record (default WidthV3Time for ExpanderV3)")
+	flag.IntVar(&calibrate, "calibrate", 0, "degree of a calibration run when there is no record (default by engine)")
+	flag.StringVar(&memory, "mem", "", "memory budget, e.g. 64G; degrees over it are flagged")
+	flag.Parse()
+
+	if begin == 0 {
+		begin = degree
+	}
+	if end == 0 {
+		end = degree
+	}
+	if end < begin {
+		end = begin
+	}
+	budget := parseBytes(memory)
+
+	var rate float64 // work units per second
+	var rateSource string
+	if record != "" {
+		if column == "" && engine == "ExpanderV3" {
+			column = "WidthV3Time"
+		}
+		rate, rateSource = recordedThroughput(engine, record, column, end)
+	} else {
+		rate, rateSource = calibrateThroughput(engine, calibrate)
+	}
+	fmt.Printf("# engine=%s throughput=%.0f/s from %s\n", engine, rate, rateSource)
+	fmt.Printf("#n partitions partbytes markbytes tablebytes totalbytes runtime fits\n")
+	for n := begin; n <= end; n++ {
+		plan, err := den.NewResourcePlan(engine, n)
+		if err != nil {
+			log.Fatal(err)
+		}
+		total := plan.TotalBytes()
+		fits := "-"
+		if budget != nil {
+			fits = "yes"
+			if total.Cmp(budget) > 0 {
+				fits = "NO"
+			}
+		}
+		fmt.Printf("%d %v %s %s %s %s %v %s\n", n, plan.Partitions,
+			formatBytes(plan.PartitionBytes), formatBytes(plan.MarkBytes), formatBytes(plan.TableBytes),
+			formatBytes(total), plan.EstimateRuntime(rate).Round(time.Second), fits)
+	}
+}
+
+// recordedThroughput takes the largest degree of the record at or
+// below n with a time of at least a second, and divides its work by
+// its time.
+func recordedThroughput(engine, path, column string, n int) (float64, string) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	index := -1
+	var bestDegree, bestSeconds int
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1<<20), 1<<20) // widths make long lines
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "#n" {
+			for i, name := range fields {
+				if name == column {
+					index = i
+				}
+			}
+			continue
+		}
+		if index < 0 || index >= len(fields) {
+			continue
+		}
+		d, err1 := strconv.Atoi(fields[0])
+		seconds, err2 := strconv.Atoi(fields[index])
+		if err1 != nil || err2 != nil || d > n || seconds < 1 {
+			continue
+		}
+		if d > bestDegree {
+			bestDegree, bestSeconds = d, seconds
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+	if index < 0 {
+		log.Fatalf("no column %q in %s", column, path)
+	}
+	if bestDegree == 0 {
+		log.Fatalf("no recorded time of a second or more at or below n=%d in %s", n, path)
+	}
+	plan, err := den.NewResourcePlan(engine, bestDegree)
+	if err != nil {
+		log.Fatal(err)
+	}
+	units, _ := new(big.Float).SetInt(plan.WorkUnits).Float64()
+	return units / float64(bestSeconds), fmt.Sprintf("%s n=%d %ds", path, bestDegree, bestSeconds)
+}
+
+func calibrateThroughput(engine string, degree int) (float64, string) {
+	var seconds float64
+	switch engine {
+	case "CPT":
+		if degree == 0 {
+			degree = 18
+		}
+		cpt, err := den.New_CPT(degree)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := cpt.Generate(); err != nil {
+			log.Fatal(err)
+		}
+		seconds = (cpt.PartitionTime + cpt.GenTime).Seconds()
+	case "ExpanderV3":
+		if degree == 0 {
+			degree = 45
+		}
+		exp, err := den.NewExpanderV3(degree)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := exp.WidthContext(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+		seconds = exp.TimeTotalToComputeWidth.Seconds()
+	default:
+		log.Fatalf("unknown engine: %s", engine)
+	}
+	if seconds <= 0 {
+		log.Fatalf("calibration at n=%d too quick to time; raise -calibrate", degree)
+	}
+	plan, err := den.NewResourcePlan(engine, degree)
+	if err != nil {
+		log.Fatal(err)
+	}
+	units, _ := new(big.Float).SetInt(plan.WorkUnits).Float64()
+	return units / seconds, fmt.Sprintf("calibration n=%d %.1fs", degree, seconds)
+}
+
+var byteUnits = []string{"", "K", "M", "G", "T", "P", "E"}
+
+func formatBytes(b *big.Int) string {
+	x, _ := new(big.Float).SetInt(b).Float64()
+	i := 0
+	for x >= 1024 && i < len(byteUnits)-1 {
+		x /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f", x)
+	}
+	return fmt.Sprintf("%.1f%s", x, byteUnits[i])
+}
+
+func parseBytes(s string) *big.Int {
+	if s == "" {
+		return nil
+	}
+	b, err := den.ParseByteSize(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return big.NewInt(b)
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPlanExpanderV3MatchesExpander(t *testing.T) {
+	maxDegree := 30
+	if testing.Short() {
+		maxDegree = 20
+	}
+	for d := 1; d <= maxDegree; d++ {
+		plan, err := NewResourcePlan("ExpanderV3", d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp, err := NewExpanderV3(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp.ensureSortedPartitions()
+		exp.ensureMarkTable()
+		if n := plan.Partitions.Int64(); n != int64(exp.partitions.Len()) {
+			t.Errorf("partitions; d=%d expected=%d got=%d", d, exp.partitions.Len(), n)
+		}
+		if b := plan.PartitionBytes.Int64(); b != int64(exp.partitions.SizeBytes()) {
+			t.Errorf("partition bytes; d=%d expected=%d got=%d", d, exp.partitions.SizeBytes(), b)
+		}
+		if b := plan.MarkBytes.Int64(); b != int64(exp.markTable.sizeBytes()) {
+			t.Errorf("mark bytes; d=%d expected=%d got=%d", d, exp.markTable.sizeBytes(), b)
+		}
+	}
+}
+
+func TestPlanCPTWorkUnitsAreImages(t *testing.T) {
+	for d := 1; d <= 10; d++ {
+		plan, err := NewResourcePlan("CPT", d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cpt, err := New_CPT(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := cpt.Generate(); err != nil {
+			t.Fatal(err)
+		}
+		images := 0
+		for _, row := range cpt.rows {
+			images += len(row.images)
+		}
+		if plan.WorkUnits.Int64() != int64(images) {
+			t.Errorf("images; d=%d expected=%d got=%v", d, images, plan.WorkUnits)
+		}
+		if plan.TotalBytes().Cmp(plan.TableBytes) <= 0 {
+			t.Errorf("expected types and markup in total; d=%d", d)
+		}
+	}
+}
+
+func TestPlanCPTSampledImages(t *testing.T) {
+	d := cptPlanExactDegree + 20
+	if testing.Short() {
+		d = cptPlanExactDegree + 5
+	}
+	plan, err := NewResourcePlan("CPT", d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := 0
+	var ct CycleType = make([]int, d)
+	for it := NewPartitionIterator(d, nil); it.Next(); {
+		it.Partition().CycleType(ct)
+		images += ct.OrderFactorization().NumDivisors()
+	}
+	// the sampled mean is within a few percent
+	got, _ := plan.WorkUnits.Float64()
+	if r := got / float64(images); r < 0.9 || r > 1.1 {
+		t.Errorf("images; d=%d expected about %d got=%v", d, images, plan.WorkUnits)
+	}
+	if _, err := NewResourcePlan("CPT", MaxTypeDegree+1); err == nil {
+		t.Errorf("expected no CPT plan beyond MaxTypeDegree")
+	}
+}
+
+func TestPlanEstimateRuntime(t *testing.T) {
+	plan, err := NewResourcePlan("ExpanderV3", 10) // 42 partitions
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := plan.EstimateRuntime(21); got != 2*time.Second {
+		t.Errorf("expected 2s got=%v", got)
+	}
+	if got := plan.EstimateRuntime(0); got != 0 {
+		t.Errorf("expected no estimate without throughput; got=%v", got)
+	}
+}
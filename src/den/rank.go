@@ -0,0 +1,198 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// ranking and unranking of partitions in ruleAsc order, i.e. the
+// lexicographic order of the parts written in ascending order.
+//
+// let P(r, k) be the number of partitions of r with every part >= k.
+// a partition a_1 <= a_2 <= ... <= a_m of n is preceded by exactly
+// those partitions that agree with it on a_1..a_{i-1} and have some
+// smaller x in [a_{i-1}, a_i) at position i, of which there are
+// P(r_i - x, x), where r_i = a_i + ... + a_m.  summing over i and x
+// gives the rank.
+
+// PartitionRanker holds the count tables for degrees up to its limit.
+type PartitionRanker struct {
+	maxDegree int
+	// atLeast[r][k] = P(r, k), for 0 <= r <= maxDegree and
+	// 1 <= k <= maxDegree+1.
+	atLeast [][]int
+	// below[r][x] = sum of P(r - y, y) for 1 <= y < x, the number of
+	// partitions of r whose smallest part is less than x.
+	below [][]int
+}
+
+func NewPartitionRanker(maxDegree int) (*PartitionRanker, error) {
+	if err := checkDegree("partition ranker", maxDegree, maxRankableDegree); err != nil {
+		return nil, err
+	}
+	N := maxDegree
+	atLeast := make([][]int, N+1)
+	below := make([][]int, N+1)
+	for r := 0; r <= N; r++ {
+		atLeast[r] = make([]int, N+2)
+	}
+	atLeast[0][N+1] = 1
+	for r := 0; r <= N; r++ {
+		for k := N; k >= 1; k-- {
+			x := atLeast[r][k+1]
+			if r == 0 {
+				x = 1
+			} else if k <= r {
+				y := atLeast[r-k][k]
+				if x > math.MaxInt64-y {
+					return nil, fmt.Errorf("partition counts overflow int; degree=%d", maxDegree)
+				}
+				x += y
+			}
+			atLeast[r][k] = x
+		}
+	}
+	for r := 0; r <= N; r++ {
+		below[r] = make([]int, N+2)
+		for x := 1; x <= N; x++ {
+			c := 0
+			if x <= r {
+				c = atLeast[r-x][x]
+			}
+			below[r][x+1] = below[r][x] + c
+		}
+	}
+	return &PartitionRanker{maxDegree: N, atLeast: atLeast, below: below}, nil
+}
+
+func (pr *PartitionRanker) MaxDegree() int {
+	return pr.maxDegree
+}
+
+// Count returns p(n), the number of partitions of n.
+func (pr *PartitionRanker) Count(n int) int {
+	pr.check(n)
+	return pr.atLeast[n][1]
+}
+
+func (pr *PartitionRanker) check(n int) {
+	if n < 0 || n > pr.maxDegree {
+		panic(fmt.Sprintf("degree out of range of ranker; n=%d max=%d", n, pr.maxDegree))
+	}
+}
+
+// Rank returns the index of p among the partitions of its sum in
+// ruleAsc order.  the parts of p must be ascending.
+func (pr *PartitionRanker) Rank(p Partition) int {
+	r := p.Sum()
+	pr.check(r)
+	rank := 0
+	lo := 1
+	for _, a := range p {
+		rank += pr.below[r][a] - pr.below[r][lo]
+		r -= a
+		lo = a
+	}
+	return rank
+}
+
+// RankCycleType is Rank for a type in sagan form, without converting
+// it to parts.
+func (pr *PartitionRanker) RankCycleType(t CycleType) int {
+	r := t.DegreeOld()
+	pr.check(r)
+	rank := 0
+	lo := 1
+	for i, m := range t {
+		a := i + 1
+		for j := 0; j < m; j++ {
+			rank += pr.below[r][a] - pr.below[r][lo]
+			r -= a
+			lo = a
+		}
+	}
+	return rank
+}
+
+// Unrank returns the partition of n with the given rank in ruleAsc
+// order.
+func (pr *PartitionRanker) Unrank(n, rank int) Partition {
+	var p Partition
+	pr.UnrankInto(n, rank, &p, make([]int, n))
+	return p
+}
+
+// UnrankInto is Unrank writing the parts into buf, which must have
+// room for n parts.
+func (pr *PartitionRanker) UnrankInto(n, rank int, p *Partition, buf []int) {
+	pr.check(n)
+	if rank < 0 || rank >= pr.Count(n) {
+		panic(fmt.Sprintf("rank out of range; n=%d rank=%d count=%d", n, rank, pr.Count(n)))
+	}
+	k := 0
+	r := n
+	x := 1
+	for r > 0 {
+		// skip the blocks of partitions whose next part is x, then
+		// x+1, ..., until the rank falls inside one.
+		for c := pr.atLeast[r-x][x]; rank >= c; c = pr.atLeast[r-x][x] {
+			rank -= c
+			x++
+		}
+		buf[k] = x
+		k++
+		r -= x
+	}
+	*p = buf[:k]
+}
+
+// UnrankCycleType is Unrank producing sagan form in t, which must
+// have length n.
+func (pr *PartitionRanker) UnrankCycleType(n, rank int, t CycleType) {
+	var p Partition
+	pr.UnrankInto(n, rank, &p, make([]int, n))
+	p.CycleType(t)
+}
+
+var sharedRanker struct {
+	sync.Mutex
+	ranker *PartitionRanker
+}
+
+// RankerFor returns a shared ranker covering degree n.
+func RankerFor(n int) *PartitionRanker {
+	sharedRanker.Lock()
+	defer sharedRanker.Unlock()
+	if sharedRanker.ranker == nil || sharedRanker.ranker.maxDegree < n {
+		N := 2 * n
+		if sharedRanker.ranker == nil && N < 64 {
+			N = 64
+		}
+		if N > maxRankableDegree {
+			N = maxRankableDegree
+		}
+		if N < n {
+			N = n
+		}
+		ranker, err := NewPartitionRanker(N)
+		if err != nil {
+			panic(err)
+		}
+		sharedRanker.ranker = ranker
+	}
+	return sharedRanker.ranker
+}
+
+// p(n) fits in an int64 up to n = 405.
+const maxRankableDegree = 405
+
+func Rank(p Partition) int {
+	return RankerFor(p.Sum()).Rank(p)
+}
+
+func Unrank(n, rank int) Partition {
+	return RankerFor(n).Unrank(n, rank)
+}
@@ -0,0 +1,58 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"testing"
+)
+
+func TestRankUnrankRuleAscOrder(t *testing.T) {
+	maxDegree := 50
+	if testing.Short() {
+		maxDegree = 35
+	}
+	ranker, err := NewPartitionRanker(maxDegree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for d := 1; d <= maxDegree; d++ {
+		partitions := AllPartitions(d)
+		if ranker.Count(d) != len(partitions) {
+			t.Errorf("count mismatch; d=%d expected=%d got=%d", d, len(partitions), ranker.Count(d))
+		}
+		ct := make(CycleType, d)
+		for i, p := range partitions {
+			if r := ranker.Rank(p); r != i {
+				t.Errorf("rank mismatch; d=%d p=%v expected=%d got=%d", d, p, i, r)
+			}
+			p.CycleType(ct)
+			if r := ranker.RankCycleType(ct); r != i {
+				t.Errorf("cycle type rank mismatch; d=%d t=%v expected=%d got=%d", d, &ct, i, r)
+			}
+			if q := ranker.Unrank(d, i); !q.Equal(p) {
+				t.Errorf("unrank mismatch; d=%d rank=%d expected=%v got=%v", d, i, p, q)
+			}
+			u := make(CycleType, d)
+			ranker.UnrankCycleType(d, i, u)
+			if !u.Equal(&ct) {
+				t.Errorf("cycle type unrank mismatch; d=%d rank=%d expected=%v got=%v", d, i, &ct, &u)
+			}
+		}
+	}
+}
+
+func TestRankLargeDegree(t *testing.T) {
+	// p(405) is the largest partition number that fits in an int64
+	n := 405
+	last := Unrank(n, RankerFor(n).Count(n)-1)
+	if !last.Equal(Partition{n}) {
+		t.Errorf("expected last partition to be [%d] got=%v", n, last)
+	}
+	if RankerFor(n).Count(n) != 9147679068859117602 {
+		t.Errorf("unexpected p(405)=%d", RankerFor(n).Count(n))
+	}
+	p := Partition{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 350}
+	if q := Unrank(n, Rank(p)); !q.Equal(p) {
+		t.Errorf("round trip failed; expected=%v got=%v", p, q)
+	}
+}
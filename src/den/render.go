@@ -0,0 +1,72 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// renderer streams text through a buffer to a writer.  it keeps the
+// byte count and the first error, so the table renderers can be
+// written straight through and checked once, by done, at the end.
+// memory is bounded by the buffer whatever the size of the output.
+type renderer struct {
+	w *bufio.Writer
+	n int64
+	err error
+	scratch []byte
+}
+
+func newRenderer(w io.Writer) *renderer {
+	r := &renderer{}
+	r.w = bufio.NewWriterSize(writerFunc(func(b []byte) (int, error) {
+		k, err := w.Write(b)
+		r.n += int64(k)
+		return k, err
+	}), 64<<10)
+	return r
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) {
+	return f(b)
+}
+
+func (r *renderer) print(s string) {
+	if r.err == nil {
+		_, r.err = r.w.WriteString(s)
+	}
+}
+
+func (r *renderer) printf(format string, args ...interface{}) {
+	if r.err == nil {
+		_, r.err = fmt.Fprintf(r.w, format, args...)
+	}
+}
+
+func (r *renderer) int(x int) {
+	if r.err == nil {
+		r.scratch = strconv.AppendInt(r.scratch[:0], int64(x), 10)
+		_, r.err = r.w.Write(r.scratch)
+	}
+}
+
+func (r *renderer) done() (int64, error) {
+	if r.err == nil {
+		r.err = r.w.Flush()
+	}
+	return r.n, r.err
+}
+
+// renderString collects the output of a renderer, for the String
+// forms.
+func renderString(render func(io.Writer) (int64, error)) string {
+	var b strings.Builder
+	render(&b)
+	return b.String()
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+type failingWriter struct {
+	limit int
+}
+
+func (f *failingWriter) Write(b []byte) (int, error) {
+	if len(b) > f.limit {
+		n := f.limit
+		f.limit = 0
+		return n, errors.New("full")
+	}
+	f.limit -= len(b)
+	return len(b), nil
+}
+
+func TestRenderersStream(t *testing.T) {
+	cpt, err := New_CPT(9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cpt.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	cpt.Width()
+	exp, err := NewExpanderV3(9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.NumMaximalTypes()
+	P, err := NewPFT(9, CycleType{0, 2, 0, 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	P.Generate()
+	tcase := func(name string, render func(io.Writer) (int64, error), expected string) {
+		var b bytes.Buffer
+		n, err := render(&b)
+		if err != nil || n != int64(len(expected)) || b.String() != expected {
+			t.Errorf("%s; n=%d err=%v expected %d bytes", name, n, err, len(expected))
+		}
+		if len(expected) < 2 {
+			return
+		}
+		f := &failingWriter{limit: len(expected) / 2}
+		n, err = render(f)
+		if err == nil || n != int64(len(expected)/2) {
+			t.Errorf("%s; expected write error after half; n=%d err=%v", name, n, err)
+		}
+	}
+	tcase("cpt", cpt.WriteTo, cpt.String())
+	tcase("table", cpt.WriteTable, cpt.TableString())
+	tcase("latex", cpt.WriteLatex, cpt.Latex())
+	tcase("dot", cpt.WriteDot, cpt.Dot())
+	tcase("maximal", cpt.WriteMaximalTypesMatrix, cpt.MaximalTypesMatrixString())
+	tcase("pft", P.WriteTo, P.String())
+	tcase("expander", exp.WriteTo, exp.String())
+}
@@ -0,0 +1,140 @@
+// Copyright 2018 Adam Marks
+
+package main
+
+import (
+	"den"
+	"io"
+	"log"
+	"math"
+)
+
+// resultCache keeps the scalar results the sequences take from the
+// engines, by engine, degree and name, for the whole run, and the
+// engines themselves only while they fit the budget.  an engine is
+// rebuilt if a result it has not given is asked for after it was
+// evicted.
+//
+// engines are sized by their ResourcePlan, and evicted least recently
+// used first once the total passes the budget, except those used for
+// the row in hand: a budget of 0 keeps just those.  an evicted engine
+// that is an io.Closer, like an ExpanderV3 with mapped partitions, is
+// closed.
+type resultCache struct {
+	budget int64
+	row int
+	results map[resultKey]interface{}
+	engines []*cachedEngine // most recently used first
+	bytes int64 // saturates at math.MaxInt64
+}
+
+type engineKey struct {
+	engine string
+	n int
+}
+
+type resultKey struct {
+	engineKey
+	name string
+}
+
+type cachedEngine struct {
+	engineKey
+	engine interface{}
+	bytes int64
+	row int // of the last use
+}
+
+func newResultCache(budget int64) *resultCache {
+	return &resultCache{budget: budget, results: make(map[resultKey]interface{})}
+}
+
+// beginRow marks the engines used from now on as in use until the next
+// row.
+func (c *resultCache) beginRow(n int) {
+	c.row = n
+}
+
+// result returns the named result of the engine at degree n, calling
+// compute the first time.
+func (c *resultCache) result(engine string, n int, name string, compute func() interface{}) interface{} {
+	key := resultKey{engineKey{engine, n}, name}
+	x, found := c.results[key]
+	if !found {
+		x = compute()
+		c.results[key] = x
+	}
+	return x
+}
+
+// hasResults reports whether the engine at degree n has given any
+// result.
+func (c *resultCache) hasResults(engine string, n int) bool {
+	for key := range c.results {
+		if key.engineKey == (engineKey{engine, n}) {
+			return true
+		}
+	}
+	return false
+}
+
+// engine returns the engine at degree n, if it is held.
+func (c *resultCache) engine(engine string, n int) (interface{}, bool) {
+	for i, e := range c.engines {
+		if e.engineKey == (engineKey{engine, n}) {
+			copy(c.engines[1:i+1], c.engines[:i])
+			c.engines[0] = e
+			e.row = c.row
+			return e.engine, true
+		}
+	}
+	return nil, false
+}
+
+// add holds the engine at degree n, and evicts what no longer fits.
+func (c *resultCache) add(engine string, n int, x interface{}) {
+	e := &cachedEngine{engineKey{engine, n}, x, engineBytes(engine, n), c.row}
+	c.engines = append([]*cachedEngine{e}, c.engines...)
+	c.bytes = addBytes(c.bytes, e.bytes)
+	for i := len(c.engines) - 1; i >= 0 && c.bytes > c.budget; i-- {
+		e := c.engines[i]
+		if e.row == c.row {
+			continue
+		}
+		log.Printf("evicting %s; n=%d bytes=%d cached=%d budget=%d", e.engineKey.engine, e.n, e.bytes, c.bytes, c.budget)
+		c.engines = append(c.engines[:i], c.engines[i+1:]...)
+		if closer, ok := e.engine.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Print(err)
+			}
+		}
+		// a saturated total cannot be taken apart, so sum it again
+		c.bytes = 0
+		for _, e := range c.engines {
+			c.bytes = addBytes(c.bytes, e.bytes)
+		}
+	}
+}
+
+// addBytes adds engine sizes, saturating at math.MaxInt64.
+func addBytes(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
+
+// engineBytes is the planned size of the engine at degree n.  the
+// engines without a plan are small, but count a byte, so that a budget
+// of 0 evicts them too.
+func engineBytes(engine string, n int) int64 {
+	plan, err := den.NewResourcePlan(engine, n)
+	if err != nil {
+		return 1
+	}
+	total := plan.TotalBytes()
+	if !total.IsInt64() {
+		return math.MaxInt64
+	}
+	return total.Int64()
+}
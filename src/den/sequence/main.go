@@ -3,7 +3,9 @@
 package main
 
 import (
+	"context"
 	"den"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/pkg/profile"
@@ -12,20 +14,57 @@ import (
 	"math/big"
 	"os"
 	"runtime"
+	"time"
 )
 
 func main() {
 	begin := 1
 	end := 10
 	list := false
+	workers := 0
 	var prof string
+	var partitionDir string
+	var memory string
+	var cacheMemory string
+	var checkpointDir string
+	var every time.Duration
+	var resume bool
+	var metricsAddr string
+	var report string
 
 	flag.IntVar(&begin, "b", begin, "begin index")
 	flag.IntVar(&end, "e", end, "end index")
 	flag.BoolVar(&list, "l", list, "list available sequence names")
 	flag.StringVar(&prof, "prof", "", "enabling profiling: cpu or mem")
+	flag.IntVar(&workers, "workers", workers, "number of expander workers (0 for one per cpu)")
+	flag.StringVar(&partitionDir, "partition-dir", "", "directory of partition files for ExpanderV3 (see gen-partition-file)")
+	flag.StringVar(&memory, "mem", "", "memory budget per ExpanderV3, e.g. 8G")
+	flag.StringVar(&cacheMemory, "cache-mem", "", "memory for engines kept past their degree, e.g. 4G; by default only those of the current degree are kept")
+	flag.StringVar(&checkpointDir, "checkpoint-dir", "", "directory of ExpanderV3 checkpoints, written periodically and on SIGINT")
+	flag.DurationVar(&every, "checkpoint-every", den.DefaultCheckpointInterval, "interval between checkpoints")
+	flag.BoolVar(&resume, "resume", false, "continue ExpanderV3 degrees from their checkpoints (default dir .)")
+	flag.StringVar(&metricsAddr, "metrics", "", "serve live metrics on this address, e.g. localhost:9090")
+	flag.StringVar(&report, "report", "", "write a json run report to this file at the end")
 	flag.Parse()
 
+	if resume && checkpointDir == "" {
+		checkpointDir = "."
+	}
+
+	var budget, cacheBudget int64
+	if memory != "" {
+		var err error
+		if budget, err = den.ParseByteSize(memory); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if cacheMemory != "" {
+		var err error
+		if cacheBudget, err = den.ParseByteSize(cacheMemory); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	if list {
 		listSequences()
 		return
@@ -42,15 +81,40 @@ func main() {
 	}
 
 	seqNames := flag.Args()
-	sequences := NewSequences(seqNames)
+	context := NewSequenceContext(workers, cacheBudget)
+	context.partitionDir = partitionDir
+	context.memoryBudget = budget
+	if checkpointDir != "" {
+		context.checkpointDir = checkpointDir
+		context.checkpointInterval = every
+		context.resume = resume
+		context.interrupt = den.InterruptOnSignal()
+	}
+	metrics, err := den.StartMetrics(nil, metricsAddr, report)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if metrics != nil {
+		context.observer = metrics
+	}
+	context.metrics = metrics
+	context.report = report
+	defer func() {
+		if err := metrics.WriteReport(report); err != nil {
+			log.Print(err)
+		}
+	}()
+	sequences := NewSequences(seqNames, context)
 	printHeader(seqNames)
 
 	for i := begin; i <= end; i++ {
+		context.beginRow(i)
 		fmt.Printf("%d", i)
 		for _, seq := range sequences {
 			fmt.Printf(" %v", seq.ValueAtIndex(i))
 		}
 		fmt.Printf("\n")
+		context.removeCheckpoint(i)
 	}
 }
 
@@ -75,58 +139,177 @@ type Sequence interface {
 // junk drawer
 type SequenceContext struct {
 	exp *den.Expander
-	expV3 map[int]*den.ExpanderV3
-	cpt *den.CPT
-	needsPrevCpt bool
-	prevCpt *den.CPT
+	cache *resultCache
 	cumulativeDensitySum float64
+	numWorkers int
+	partitionDir string
+	memoryBudget int64
+	checkpointDir string
+	checkpointInterval time.Duration
+	resume bool
+	interrupt <-chan struct{}
+	observer den.Observer // nil to log
+	metrics *den.Metrics // nil unless metrics are served or reported
+	report string
+}
+
+// cacheBudget bounds the engines kept for later degrees; see
+// resultCache.
+func NewSequenceContext(numWorkers int, cacheBudget int64) *SequenceContext {
+	return &SequenceContext{cache: newResultCache(cacheBudget), numWorkers: numWorkers}
 }
 
-func NewSequenceContext() *SequenceContext {
-	return &SequenceContext{expV3: make(map[int]*den.ExpanderV3)}
+// beginRow is called before the sequences are asked for their values
+// at n.
+func (ctx *SequenceContext) beginRow(n int) {
+	ctx.cache.beginRow(n)
 }
 
 func (ctx *SequenceContext) Cpt(n int) *den.CPT {
-	if ctx.cpt != nil && ctx.cpt.Degree() == n {
-		return ctx.cpt
-	}
-	if ctx.prevCpt != nil && ctx.prevCpt.Degree() == n {
-		return ctx.prevCpt
+	if cpt, found := ctx.cache.engine("CPT", n); found {
+		return cpt.(*den.CPT)
 	}
-	if ctx.needsPrevCpt && ctx.cpt != nil {
-		log.Printf("Saving CPT context for degree %d", ctx.cpt.Degree())
-		ctx.prevCpt = ctx.cpt
+	cpt, err := den.New_CPT(n)
+	if err != nil {
+		panic(err)
 	}
-	ctx.cpt = den.New_CPT(n)
-	if err := ctx.cpt.Generate(); err != nil {
+	cpt.SetObserver(ctx.observer)
+	if err := cpt.Generate(); err != nil {
 		panic(err)
 	}
-	if err := ctx.cpt.Check(); err != nil {
+	if err := cpt.Check(); err != nil {
 		panic(err)
 	}
-	return ctx.cpt
+	ctx.cache.add("CPT", n, cpt)
+	return cpt
 }
 
-func (ctx *SequenceContext) SetNeedsPrevCpt(b bool) {
-	ctx.needsPrevCpt = b
+// CptResult returns the named result of the CPT of degree n, computed
+// by f the first time.
+func (ctx *SequenceContext) CptResult(n int, name string, f func(cpt *den.CPT) interface{}) interface{} {
+	return ctx.cache.result("CPT", n, name, func() interface{} { return f(ctx.Cpt(n)) })
+}
+
+func (ctx *SequenceContext) CptDensity(n int) *big.Rat {
+	return ctx.CptResult(n, "Density", func(cpt *den.CPT) interface{} { return cpt.Density() }).(*big.Rat)
 }
 
 func (ctx *SequenceContext) Expander(n int) *den.Expander {
 	if ctx.exp == nil || ctx.exp.Degree() != n {
-		ctx.exp = den.NewExpander(n)
+		exp, err := den.NewExpander(n)
+		if err != nil {
+			panic(err)
+		}
+		ctx.exp = exp
 	}
 	return ctx.exp
 }
 
+// ExpanderV3 extends the expander of n-1 if it is still held.
 func (ctx *SequenceContext) ExpanderV3(n int) *den.ExpanderV3 {
-	if _, found := ctx.expV3[n]; !found {
-		ctx.expV3[n] = den.NewExpanderV3(n)
+	if exp, found := ctx.cache.engine("ExpanderV3", n); found {
+		return exp.(*den.ExpanderV3)
+	}
+	path := ""
+	if ctx.partitionDir != "" {
+		path = den.PartitionFilePath(ctx.partitionDir, n)
+		if _, err := os.Stat(path); err != nil {
+			path = ""
+		}
+	}
+	resume := ""
+	if ctx.resume {
+		resume = den.CheckpointPath(ctx.checkpointDir, n)
+		if _, err := os.Stat(resume); err != nil {
+			resume = ""
+		}
+	}
+	var exp *den.ExpanderV3
+	var err error
+	prev, found := ctx.cache.engine("ExpanderV3", n-1)
+	if found && path == "" && ctx.memoryBudget == 0 && resume == "" {
+		exp, err = prev.(*den.ExpanderV3).Extend()
+	} else if exp, err = den.NewExpanderV3(n); err == nil {
+		exp.SetNumWorkers(ctx.numWorkers)
+		exp.SetPartitionFile(path)
+		exp.SetMemoryBudget(ctx.memoryBudget)
+		exp.SetObserver(ctx.observer)
+	}
+	if err != nil {
+		panic(err)
+	}
+	if ctx.checkpointDir != "" {
+		exp.SetCheckpoint(den.CheckpointPath(ctx.checkpointDir, n), ctx.checkpointInterval)
+		exp.SetInterrupt(ctx.interrupt)
+	}
+	if resume != "" {
+		exp.ResumeFrom(resume)
+	}
+	ctx.cache.add("ExpanderV3", n, exp)
+	return exp
+}
+
+func (ctx *SequenceContext) ExpanderV3Result(n int, name string, f func(exp *den.ExpanderV3) interface{}) interface{} {
+	return ctx.cache.result("ExpanderV3", n, name, func() interface{} { return f(ctx.ExpanderV3(n)) })
+}
+
+func (ctx *SequenceContext) WidthV3(n int) *big.Int {
+	return ctx.ExpanderV3Result(n, "Width", func(exp *den.ExpanderV3) interface{} { return ctx.widthV3(exp) }).(*big.Int)
+}
+
+// widthV3 sums the width of exp, stopping the run if it is
+// interrupted.
+func (ctx *SequenceContext) widthV3(exp *den.ExpanderV3) *big.Int {
+	width, err := exp.WidthContext(context.Background())
+	ctx.check(err)
+	return width
+}
+
+// check panics with err, as the engines do, but an interrupted
+// expander has written its checkpoint, so the run writes its report
+// and exits with the status of a SIGINT.
+func (ctx *SequenceContext) check(err error) {
+	if errors.Is(err, den.ErrInterrupted) {
+		if err := ctx.metrics.WriteReport(ctx.report); err != nil {
+			log.Print(err)
+		}
+		log.Printf("stopped at checkpoint; continue with -resume -b at the interrupted degree")
+		os.Exit(130)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+// removeCheckpoint removes the checkpoint of degree n once its row is
+// printed; an expander left at its marks keeps one for a later width.
+func (ctx *SequenceContext) removeCheckpoint(n int) {
+	if ctx.checkpointDir == "" || !ctx.cache.hasResults("ExpanderV3", n) {
+		return
+	}
+	if err := os.Remove(den.CheckpointPath(ctx.checkpointDir, n)); err != nil && !os.IsNotExist(err) {
+		log.Print(err)
 	}
-	return ctx.expV3[n]
 }
 
-func NewSequences(names []string) []Sequence {
-	context := NewSequenceContext()
+func (ctx *SequenceContext) ExpanderV4(n int) *den.ExpanderV4 {
+	if exp, found := ctx.cache.engine("ExpanderV4", n); found {
+		return exp.(*den.ExpanderV4)
+	}
+	exp, err := den.NewExpanderV4(n)
+	if err != nil {
+		panic(err)
+	}
+	exp.SetNumWorkers(ctx.numWorkers)
+	ctx.cache.add("ExpanderV4", n, exp)
+	return exp
+}
+
+func (ctx *SequenceContext) ExpanderV4Result(n int, name string, f func(exp *den.ExpanderV4) interface{}) interface{} {
+	return ctx.cache.result("ExpanderV4", n, name, func() interface{} { return f(ctx.ExpanderV4(n)) })
+}
+
+func NewSequences(names []string, context *SequenceContext) []Sequence {
 	sequences := make([]Sequence, len(names))
 	for i, name := range names {
 		sequences[i] = NewSequenceByName(name, context)
@@ -142,12 +325,14 @@ type NamedSequenceConstructor struct {
 var availableSequences []*NamedSequenceConstructor = []*NamedSequenceConstructor{
 	&NamedSequenceConstructor{"Density", NewDensitySequence},
 	&NamedSequenceConstructor{"DensityV3", NewDensityV3Sequence},
+	&NamedSequenceConstructor{"DensityV4", NewDensityV4Sequence},
 	&NamedSequenceConstructor{"DensityDelta", NewDensityDeltaSequence},
 	&NamedSequenceConstructor{"DensitySum", NewDensitySumSequence},
 	&NamedSequenceConstructor{"MinCardinalityCentralizerMaximalType", NewMinCardinalityCentralizerMaximalTypeSequence},
 	&NamedSequenceConstructor{"MinTotientLcmMaximalType", NewMinTotientLcmMaximalTypeSequence},
 	&NamedSequenceConstructor{"NumMaximalTypes", NewNumMaximalTypesSequence},
 	&NamedSequenceConstructor{"NumMaximalTypesV3", NewNumMaximalTypesV3Sequence},
+	&NamedSequenceConstructor{"NumMaximalTypesV4", NewNumMaximalTypesV4Sequence},
 	&NamedSequenceConstructor{"NumTypes", NewNumTypesSequence},
 	&NamedSequenceConstructor{"TypeStoreSizeWithParts", NewTypeStoreSizeWithPartsSequence},
 	&NamedSequenceConstructor{"TypeStoreSizeWithSlots", NewTypeStoreSizeWithSlotsSequence},
@@ -157,7 +342,9 @@ var availableSequences []*NamedSequenceConstructor = []*NamedSequenceConstructor
 	&NamedSequenceConstructor{"WidthV3Time", NewWidthV3TimeSequence},
 	&NamedSequenceConstructor{"WidthV3SuccessiveRatio", NewWidthV3SuccessiveRatioSequence},
 	&NamedSequenceConstructor{"WidthV3RatioToPreviousFactorial", NewWidthV3RatioToPreviousFactorialSequence},
-	&NamedSequenceConstructor{"WidthV3RatioToPreviousFactorialTimesSquareRoot", NewWidthV3RatioToPreviousFactorialTimesSquareRootSequence}}
+	&NamedSequenceConstructor{"WidthV3RatioToPreviousFactorialTimesSquareRoot", NewWidthV3RatioToPreviousFactorialTimesSquareRootSequence},
+	&NamedSequenceConstructor{"WidthV4", NewWidthV4Sequence},
+	&NamedSequenceConstructor{"WidthV4Time", NewWidthV4TimeSequence}}
 
 func NewSequenceByName(name string, context *SequenceContext) Sequence {
 	var sequence *NamedSequenceConstructor
@@ -184,8 +371,9 @@ func NewNumMaximalTypesSequence(context *SequenceContext) Sequence {
 }
 
 func (s *NumMaximalTypesSequence) ValueAtIndex(n int) interface{} {
-	cpt := s.context.Cpt(n)
-	return float64(cpt.NumMaximalTypes())
+	return s.context.CptResult(n, "NumMaximalTypes", func(cpt *den.CPT) interface{} {
+		return float64(cpt.NumMaximalTypes())
+	})
 }
 
 ////////////////////////////////////////////////////////////
@@ -198,10 +386,9 @@ func NewNumTypesSequence(context *SequenceContext) Sequence {
 }
 
 func (s *NumTypesSequence) ValueAtIndex(n int) interface{} {
-	var yield chan den.Partition = den.YieldAllPartitions(n)
 	k := big.NewInt(0)
 	one := big.NewInt(1)
-	for range yield {
+	for it := den.NewPartitionIterator(n, nil); it.Next(); {
 		k.Add(k, one)
 	}
 	return(k)
@@ -217,8 +404,9 @@ func NewMinCardinalityCentralizerMaximalTypeSequence(context *SequenceContext) S
 }
 
 func (s *MinCardinalityCentralizerMaximalTypeSequence) ValueAtIndex(n int) interface{} {
-	cpt := s.context.Cpt(n)
-	return float64(cpt.MinCardinalityCentralizerMaximalType().Int64())
+	return s.context.CptResult(n, "MinCardinalityCentralizerMaximalType", func(cpt *den.CPT) interface{} {
+		return float64(cpt.MinCardinalityCentralizerMaximalType().Int64())
+	})
 }
 
 ////////////////////////////////////////////////////////////
@@ -231,8 +419,9 @@ func NewMinTotientLcmMaximalTypeSequence(context *SequenceContext) Sequence {
 }
 
 func (s *MinTotientLcmMaximalTypeSequence) ValueAtIndex(n int) interface{} {
-	cpt := s.context.Cpt(n)
-	return float64(cpt.MinTotientLcmMaximalType().Int64())
+	return s.context.CptResult(n, "MinTotientLcmMaximalType", func(cpt *den.CPT) interface{} {
+		return float64(cpt.MinTotientLcmMaximalType().Int64())
+	})
 }
 
 ////////////////////////////////////////////////////////////
@@ -245,8 +434,7 @@ func NewDensitySumSequence(context *SequenceContext) Sequence {
 }
 
 func (s *DensitySumSequence) ValueAtIndex(n int) interface{} {
-	cpt := s.context.Cpt(n)
-	x, exact := cpt.Density().Float64()
+	x, exact := s.context.CptDensity(n).Float64()
 	if !exact {
 		log.Printf("warning: inexact Float64 n=%d x=%f", n, x)
 	}
@@ -264,16 +452,18 @@ func NewDensitySequence(context *SequenceContext) Sequence {
 }
 
 func (s *DensitySequence) ValueAtIndex(n int) interface{} {
-	cpt := s.context.Cpt(n)
-	den, exact := cpt.Density().Float64()
+	x, exact := s.context.CptDensity(n).Float64()
 	if !exact {
-		log.Printf("warning: inexact Float64 n=%d den=%f", n, den)
+		log.Printf("warning: inexact Float64 n=%d den=%f", n, x)
 	}
-	log.Printf("n=%d den=%v partitiontime=%d gentime=%d widthtime=%d",
-		n, den, int(cpt.PartitionTime.Seconds()),
-		int(cpt.GenTime.Seconds()),
-		int(cpt.WidthTime.Seconds()))
-	return den
+	if cpt, found := s.context.cache.engine("CPT", n); found {
+		cpt := cpt.(*den.CPT)
+		log.Printf("n=%d den=%v partitiontime=%d gentime=%d widthtime=%d",
+			n, x, int(cpt.PartitionTime.Seconds()),
+			int(cpt.GenTime.Seconds()),
+			int(cpt.WidthTime.Seconds()))
+	}
+	return x
 }
 
 ////////////////////////////////////////////////////////////
@@ -282,18 +472,16 @@ type DensityDeltaSequence struct {
 }
 
 func NewDensityDeltaSequence(context *SequenceContext) Sequence {
-	context.SetNeedsPrevCpt(true)
 	return &DensityDeltaSequence{context}
 }
 
 func (s *DensityDeltaSequence) ValueAtIndex(n int) interface{} {
-	cpt := s.context.Cpt(n)
 	prevDensity := big.NewRat(0, 1)
 	if n > 1 {
-		prevDensity = s.context.Cpt(n-1).Density()
+		prevDensity = s.context.CptDensity(n - 1)
 	}
 	delta := big.NewRat(0, 1)
-	delta.Sub(cpt.Density(), prevDensity)
+	delta.Sub(s.context.CptDensity(n), prevDensity)
 	x, exact := delta.Float64()
 	if !exact {
 		log.Printf("warning: inexact Float64 n=%d x=%f", n, x)
@@ -311,8 +499,7 @@ func NewWidthSequence(context *SequenceContext) Sequence {
 }
 
 func (s *WidthSequence) ValueAtIndex(n int) interface{} {
-	cpt := s.context.Cpt(n)
-	return cpt.Width()
+	return s.context.CptResult(n, "Width", func(cpt *den.CPT) interface{} { return cpt.Width() })
 }
 
 ////////////////////////////////////////////////////////////
@@ -327,10 +514,10 @@ func NewTypeStoreSizeWithSlotsSequence(context *SequenceContext) Sequence {
 func (s *TypeStoreSizeWithSlotsSequence) ValueAtIndex(n int) interface{} {
 	exp := s.context.Expander(n)
 	runtime.GC()
-	heapBefore := heapSize()
+	heapBefore := den.HeapSize()
 	types := exp.AllCycleTypes()
 	runtime.GC()
-	heapSize := heapSize() - heapBefore
+	heapSize := den.HeapSize() - heapBefore
 	log.Printf("n=%d types=%d heap=%d countparttime=%d gentypetime=%d",
 		n, len(types), heapSize, int(exp.TimeToCountPartitions.Seconds()),
 		int(exp.TimeToGenerateCycleTypes.Seconds()))
@@ -346,25 +533,25 @@ func NewTypeStoreSizeWithPartsSequence(context *SequenceContext) Sequence {
 	return &TypeStoreSizeWithPartsSequence{context}
 }
 
+// measures the packed partition store used by ExpanderV3 and the
+// abel table.
 func (s *TypeStoreSizeWithPartsSequence) ValueAtIndex(n int) interface{} {
-	exp := s.context.Expander(n)
 	runtime.GC()
-	heapBefore := heapSize()
-	partitions := exp.AllPartitions()
+	heapBefore := den.HeapSize()
+	t0 := time.Now()
+	partitions, err := den.NewPartitionStore(n)
+	if err != nil {
+		panic(err)
+	}
+	genPartTime := time.Since(t0)
 	runtime.GC()
-	heapSize := heapSize() - heapBefore
-	log.Printf("n=%d parts=%d heap=%d countparttime=%d genparttime=%d",
-		n, len(partitions), heapSize, int(exp.TimeToCountPartitions.Seconds()),
-		int(exp.TimeToGeneratePartitions.Seconds()))
+	heapSize := den.HeapSize() - heapBefore
+	log.Printf("n=%d parts=%d heap=%d storebytes=%d genparttime=%d",
+		n, partitions.Len(), heapSize, partitions.SizeBytes(), int(genPartTime.Seconds()))
+	runtime.KeepAlive(partitions)
 	return heapSize
 }
 
-func heapSize() uint64 {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-	return m.HeapAlloc
-}
-
 ////////////////////////////////////////////////////////////
 type TypeStoreSortTimeSequence struct {
 	context *SequenceContext
@@ -377,13 +564,13 @@ func NewTypeStoreSortTimeSequence(context *SequenceContext) Sequence {
 func (s *TypeStoreSortTimeSequence) ValueAtIndex(n int) interface{} {
 	exp := s.context.Expander(n)
 	runtime.GC()
-	heapBefore := heapSize()
+	heapBefore := den.HeapSize()
 	types := exp.AllCycleTypes()
 	runtime.GC()
 	exp.DumpTypes(types)
 	types = exp.SortCycleTypes()
 	exp.DumpTypes(types)
-	heapSize := heapSize() - heapBefore
+	heapSize := den.HeapSize() - heapBefore
 	log.Printf("n=%d types=%d heap=%d tgen=%d tsort=%d", n, len(types), heapSize,
 		int(exp.TimeToGenerateCycleTypes.Seconds()), int(exp.TimeToSortCycleTypes.Seconds()))
 	return exp.TimeToSortCycleTypes.Seconds()
@@ -399,8 +586,10 @@ func NewNumMaximalTypesV3Sequence(context *SequenceContext) Sequence {
 }
 
 func (s *NumMaximalTypesV3Sequence) ValueAtIndex(n int) interface{} {
-	exp := s.context.ExpanderV3(n)
-	return float64(exp.NumMaximalTypes())
+	return s.context.ExpanderV3Result(n, "NumMaximalTypes", func(exp *den.ExpanderV3) interface{} {
+		s.context.check(exp.Expand())
+		return float64(exp.NumMaximalTypes())
+	})
 }
 
 ////////////////////////////////////////////////////////////
@@ -413,8 +602,7 @@ func NewWidthV3Sequence(context *SequenceContext) Sequence {
 }
 
 func (s *WidthV3Sequence) ValueAtIndex(n int) interface{} {
-	exp := s.context.ExpanderV3(n)
-	return exp.Width()
+	return s.context.WidthV3(n)
 }
 
 ////////////////////////////////////////////////////////////
@@ -427,8 +615,10 @@ func NewWidthV3TimeSequence(context *SequenceContext) Sequence {
 }
 
 func (s *WidthV3TimeSequence) ValueAtIndex(n int) interface{} {
-	exp := s.context.ExpanderV3(n)
-	return int(exp.TimeTotalToComputeWidth.Seconds())
+	return s.context.ExpanderV3Result(n, "WidthTime", func(exp *den.ExpanderV3) interface{} {
+		s.context.widthV3(exp)
+		return int(exp.TimeTotalToComputeWidth.Seconds())
+	})
 }
 
 ////////////////////////////////////////////////////////////
@@ -443,8 +633,7 @@ func NewWidthV3SuccessiveRatioSequence(context *SequenceContext) Sequence {
 func (s *WidthV3SuccessiveRatioSequence) ValueAtIndex(n int) interface{} {
 	r := big.NewRat(0, 1)
 	if n > 1 {
-		r.SetFrac(s.context.ExpanderV3(n).Width(),
-			s.context.ExpanderV3(n - 1).Width())
+		r.SetFrac(s.context.WidthV3(n), s.context.WidthV3(n - 1))
 	}
 	x, _ := r.Float64()
 	return x
@@ -460,35 +649,24 @@ func NewDensityV3Sequence(context *SequenceContext) Sequence {
 }
 
 func (s *DensityV3Sequence) ValueAtIndex(n int) interface{} {
-	exp := s.context.ExpanderV3(n)
-	x, _ := exp.Density().Float64()
+	d := big.NewRat(1, 1)
+	x, _ := d.SetFrac(s.context.WidthV3(n), den.Factorial(n)).Float64()
 	return x
 }
 
 ////////////////////////////////////////////////////////////
 type WidthV3RatioToPreviousFactorialSequence struct {
 	context *SequenceContext
-	widths []*big.Int
 }
 
 func NewWidthV3RatioToPreviousFactorialSequence(context *SequenceContext) Sequence {
-	return &WidthV3RatioToPreviousFactorialSequence{
-		context,
-		make([]*big.Int, 1), // note: empty slot for the zeroth item
-	}
+	return &WidthV3RatioToPreviousFactorialSequence{context}
 }
 
 func (s *WidthV3RatioToPreviousFactorialSequence) ValueAtIndex(n int) interface{} {
 	sum := big.NewRat(0, 1)
 	for r := 1; r <= n; r++ {
-		width := big.NewInt(0)
-		if r < len(s.widths) {
-			width = s.widths[r]
-		} else {
-			exp := s.context.ExpanderV3(r)
-			width = exp.Width()
-			s.widths = append(s.widths, width)
-		}
+		width := s.context.WidthV3(r)
 		prevFactorial := den.Factorial(r - 1)
 		x := big.NewRat(0, 1)
 		x.SetFrac(width, prevFactorial)
@@ -503,27 +681,16 @@ func (s *WidthV3RatioToPreviousFactorialSequence) ValueAtIndex(n int) interface{
 ////////////////////////////////////////////////////////////
 type WidthV3RatioToPreviousFactorialTimesSquareRootSequence struct {
 	context *SequenceContext
-	widths []*big.Int
 }
 
 func NewWidthV3RatioToPreviousFactorialTimesSquareRootSequence(context *SequenceContext) Sequence {
-	return &WidthV3RatioToPreviousFactorialTimesSquareRootSequence{
-		context,
-		make([]*big.Int, 1), // note: empty slot for the zeroth item
-	}
+	return &WidthV3RatioToPreviousFactorialTimesSquareRootSequence{context}
 }
 
 func (s *WidthV3RatioToPreviousFactorialTimesSquareRootSequence) ValueAtIndex(n int) interface{} {
 	sum := big.NewFloat(0)
 	for r := 1; r <= n; r++ {
-		width := big.NewInt(0)
-		if r < len(s.widths) {
-			width = s.widths[r]
-		} else {
-			exp := s.context.ExpanderV3(r)
-			width = exp.Width()
-			s.widths = append(s.widths, width)
-		}
+		width := s.context.WidthV3(r)
 		prevFactorial := big.NewFloat(0)
 		prevFactorial.SetInt(den.Factorial(r - 1))
 
@@ -542,3 +709,63 @@ func (s *WidthV3RatioToPreviousFactorialTimesSquareRootSequence) ValueAtIndex(n
 	return z
 }
 
+
+////////////////////////////////////////////////////////////
+type NumMaximalTypesV4Sequence struct {
+	context *SequenceContext
+}
+
+func NewNumMaximalTypesV4Sequence(context *SequenceContext) Sequence {
+	return &NumMaximalTypesV4Sequence{context}
+}
+
+func (s *NumMaximalTypesV4Sequence) ValueAtIndex(n int) interface{} {
+	return s.context.ExpanderV4Result(n, "NumMaximalTypes", func(exp *den.ExpanderV4) interface{} {
+		return float64(exp.NumMaximalTypes())
+	})
+}
+
+////////////////////////////////////////////////////////////
+type WidthV4Sequence struct {
+	context *SequenceContext
+}
+
+func NewWidthV4Sequence(context *SequenceContext) Sequence {
+	return &WidthV4Sequence{context}
+}
+
+func (s *WidthV4Sequence) ValueAtIndex(n int) interface{} {
+	return s.context.ExpanderV4Result(n, "Width", func(exp *den.ExpanderV4) interface{} { return exp.Width() })
+}
+
+////////////////////////////////////////////////////////////
+type WidthV4TimeSequence struct {
+	context *SequenceContext
+}
+
+func NewWidthV4TimeSequence(context *SequenceContext) Sequence {
+	return &WidthV4TimeSequence{context}
+}
+
+func (s *WidthV4TimeSequence) ValueAtIndex(n int) interface{} {
+	return s.context.ExpanderV4Result(n, "WidthTime", func(exp *den.ExpanderV4) interface{} {
+		exp.Width()
+		return int(exp.TimeTotalToComputeWidth.Seconds())
+	})
+}
+
+////////////////////////////////////////////////////////////
+type DensityV4Sequence struct {
+	context *SequenceContext
+}
+
+func NewDensityV4Sequence(context *SequenceContext) Sequence {
+	return &DensityV4Sequence{context}
+}
+
+func (s *DensityV4Sequence) ValueAtIndex(n int) interface{} {
+	x, _ := s.context.ExpanderV4Result(n, "Density", func(exp *den.ExpanderV4) interface{} {
+		return exp.Density()
+	}).(*big.Rat).Float64()
+	return x
+}
@@ -0,0 +1,456 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sharded expansion splits the ruleAsc index range of the partitions
+// of n into k slices, expanded by separate processes.  each shard
+// expands only the types of its slice, but their powers may fall
+// anywhere, so it writes its whole mark table, along with the heights
+// of the types of its slice.  or-ed together, the marks of the shards
+// are the marks of an unbroken run: every type is marked by the expansion
+// of a maximal type above it, whichever shard holds that type.  the
+// merge then sums the width from the merged marks and the heights,
+// without expanding anything.
+//
+// shard files are little endian:
+//
+//   offset  size  field
+//        0     8  magic "DENSHARD"
+//        8     4  version
+//       12     4  degree n
+//       16     4  shard i
+//       20     4  shards k
+//       24     8  size, p(n)
+//       32     8  begin of the slice
+//       40     8  end of the slice
+//       48     8  height bytes h
+//       56     8  crc64 (ecma) of the body
+//       64     4  crc32 (ieee) of bytes 0..63
+//       68     4  reserved, zero
+//       72        body: the mark table, (size+63)/64 uint64 words, then
+//                 the heights of the types of the slice in order, as
+//                 uvarints, h bytes
+//
+// heights are phi of the order, and the order of a type of degree at
+// most 255 fits in 64 bits.
+
+const ShardFileVersion = 1
+
+const shardFileMagic = "DENSHARD"
+const shardFileHeaderSize = 72
+
+// ShardFilePath is the conventional name of shard i of k of degree n
+// in dir.
+func ShardFilePath(dir string, n, i, k int) string {
+	return filepath.Join(dir, fmt.Sprintf("shard-%d-%d-of-%d.den", n, i, k))
+}
+
+// ParseShard parses a shard given as "i/k", with 0 <= i < k.
+func ParseShard(s string) (i, k int, err error) {
+	parts := strings.Split(s, "/")
+	if len(parts) == 2 {
+		i, err = strconv.Atoi(parts[0])
+		if err == nil {
+			k, err = strconv.Atoi(parts[1])
+		}
+		if err == nil && i >= 0 && i < k {
+			return i, k, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("bad shard %q; expected i/k with 0 <= i < k", s)
+}
+
+// shardRange returns slice i of k of [0, size).
+func shardRange(size, i, k int) (begin, end int) {
+	return int(int64(size) * int64(i) / int64(k)), int(int64(size) * int64(i+1) / int64(k))
+}
+
+// SetShard restricts Expand to slice i of k of the partitions; see
+// WriteShardFile and MergeShardFiles.  a sharded expander has no width
+// of its own.
+func (exp *ExpanderV3) SetShard(i, k int) error {
+	if i < 0 || i >= k {
+		return fmt.Errorf("bad shard; shard=%d shards=%d", i, k)
+	}
+	exp.shard, exp.shards = i, k
+	return nil
+}
+
+func (exp *ExpanderV3) sharded() bool {
+	return exp.shards > 0
+}
+
+// the marks of a shard are only part of the marks of its degree.
+func (exp *ExpanderV3) checkUnsharded() error {
+	if exp.sharded() {
+		return fmt.Errorf("%w; n=%d shard=%d/%d", ErrSharded, exp.degree, exp.shard, exp.shards)
+	}
+	return nil
+}
+
+// expansionEnd is the end of the index range to expand.
+func (exp *ExpanderV3) expansionEnd() int {
+	size := exp.partitions.Len()
+	if !exp.sharded() {
+		return size
+	}
+	_, end := shardRange(size, exp.shard, exp.shards)
+	return end
+}
+
+func (exp *ExpanderV3) expansionBegin() int {
+	if !exp.sharded() {
+		return exp.firstNew
+	}
+	begin, _ := shardRange(exp.partitions.Len(), exp.shard, exp.shards)
+	if exp.firstNew > begin {
+		return exp.firstNew
+	}
+	return begin
+}
+
+// WriteShardFile expands the shard and writes its marks and the
+// heights of its slice to path.
+func (exp *ExpanderV3) WriteShardFile(path string) (err error) {
+	if !exp.sharded() {
+		return fmt.Errorf("expander is not sharded; n=%d", exp.degree)
+	}
+	if err = exp.Expand(); err != nil {
+		return err
+	}
+	exp.ensureTypeTables()
+	size := exp.partitions.Len()
+	begin, end := shardRange(size, exp.shard, exp.shards)
+	exp.observer.Printf("writing shard; n=%d shard=%d/%d begin=%d end=%d path=%s",
+		exp.degree, exp.shard, exp.shards, begin, end, path)
+	t0 := time.Now()
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+	if _, err = f.Seek(shardFileHeaderSize, io.SeekStart); err != nil {
+		return err
+	}
+	sum := crc64.New(crc64Table)
+	counter := &countingWriter{}
+	body := bufio.NewWriterSize(io.MultiWriter(f, sum, counter), 1<<20)
+	var word [binary.MaxVarintLen64]byte
+	for i := range exp.markTable.bits {
+		binary.LittleEndian.PutUint64(word[:], atomic.LoadUint64(&exp.markTable.bits[i]))
+		body.Write(word[:8])
+	}
+	if err = body.Flush(); err != nil {
+		return err
+	}
+	marksBytes := counter.n
+	if err = exp.writeHeights(body, begin, end); err != nil {
+		return err
+	}
+	if err = body.Flush(); err != nil {
+		return err
+	}
+	h := make([]byte, shardFileHeaderSize)
+	copy(h, shardFileMagic)
+	binary.LittleEndian.PutUint32(h[8:], ShardFileVersion)
+	binary.LittleEndian.PutUint32(h[12:], uint32(exp.degree))
+	binary.LittleEndian.PutUint32(h[16:], uint32(exp.shard))
+	binary.LittleEndian.PutUint32(h[20:], uint32(exp.shards))
+	binary.LittleEndian.PutUint64(h[24:], uint64(size))
+	binary.LittleEndian.PutUint64(h[32:], uint64(begin))
+	binary.LittleEndian.PutUint64(h[40:], uint64(end))
+	binary.LittleEndian.PutUint64(h[48:], uint64(counter.n-marksBytes))
+	binary.LittleEndian.PutUint64(h[56:], sum.Sum64())
+	binary.LittleEndian.PutUint32(h[64:], crc32.ChecksumIEEE(h[:64]))
+	if _, err = f.WriteAt(h, 0); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+	exp.observer.Printf("wrote shard; n=%d shard=%d/%d bytes=%d time=%v", exp.degree, exp.shard, exp.shards,
+		shardFileHeaderSize+counter.n, time.Since(t0))
+	return nil
+}
+
+// writeHeights writes the heights of the types of [begin, end) as
+// uvarints.
+func (exp *ExpanderV3) writeHeights(w io.Writer, begin, end int) error {
+	exp.ensureTypeTables()
+	scratch := exp.types.newScratch()
+	height := big.NewInt(0)
+	var word [binary.MaxVarintLen64]byte
+	var t CycleType = make([]int, exp.degree)
+	for i := begin; i < end; i++ {
+		exp.partitions.At(i).CycleType(t)
+		exp.types.height(t, scratch, height)
+		if !height.IsUint64() {
+			return fmt.Errorf("height overflows 64 bits; n=%d type=%v", exp.degree, &t)
+		}
+		if _, err := w.Write(word[:binary.PutUvarint(word[:], height.Uint64())]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	c.n += int64(len(b))
+	return len(b), nil
+}
+
+type shardFile struct {
+	path string
+	degree int
+	shard, shards int
+	size int
+	marks []byte
+	heightSlice
+}
+
+// heightSlice holds the heights of the types of [begin, end) as
+// uvarints, as a shard file or a remote worker (see distributed.go)
+// delivers them.
+type heightSlice struct {
+	begin, end int
+	heights []byte
+	source string // for errors
+}
+
+func readShardFile(path string) (*shardFile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sf, err := decodeShardFile(b)
+	if err != nil {
+		return nil, fmt.Errorf("%v; path=%s", err, path)
+	}
+	sf.path = path
+	sf.source = path
+	return sf, nil
+}
+
+func decodeShardFile(b []byte) (*shardFile, error) {
+	if len(b) < shardFileHeaderSize || string(b[:8]) != shardFileMagic {
+		return nil, fmt.Errorf("not a shard file")
+	}
+	if crc32.ChecksumIEEE(b[:64]) != binary.LittleEndian.Uint32(b[64:]) {
+		return nil, fmt.Errorf("shard file header checksum mismatch")
+	}
+	if v := binary.LittleEndian.Uint32(b[8:]); v != ShardFileVersion {
+		return nil, fmt.Errorf("unsupported shard file version; version=%d supported=%d", v, ShardFileVersion)
+	}
+	size := binary.LittleEndian.Uint64(b[24:])
+	begin := binary.LittleEndian.Uint64(b[32:])
+	end := binary.LittleEndian.Uint64(b[40:])
+	heightBytes := binary.LittleEndian.Uint64(b[48:])
+	if begin > end || end > size {
+		return nil, fmt.Errorf("shard slice out of range; begin=%d end=%d size=%d", begin, end, size)
+	}
+	body := b[shardFileHeaderSize:]
+	marksBytes := 8 * ((size + 63) / 64)
+	if uint64(len(body)) < marksBytes || uint64(len(body))-marksBytes != heightBytes {
+		return nil, fmt.Errorf("shard file size mismatch; expected=%d got=%d",
+			shardFileHeaderSize+marksBytes+heightBytes, len(b))
+	}
+	if crc64.Checksum(body, crc64Table) != binary.LittleEndian.Uint64(b[56:]) {
+		return nil, fmt.Errorf("shard file body checksum mismatch")
+	}
+	return &shardFile{
+		degree: int(binary.LittleEndian.Uint32(b[12:])),
+		shard: int(binary.LittleEndian.Uint32(b[16:])),
+		shards: int(binary.LittleEndian.Uint32(b[20:])),
+		size: int(size),
+		marks: body[:marksBytes],
+		heightSlice: heightSlice{
+			begin: int(begin),
+			end: int(end),
+			heights: body[marksBytes:],
+		},
+	}, nil
+}
+
+// ShardMerge is the result of merging the shard files of one degree.
+type ShardMerge struct {
+	Degree int
+	Shards int
+	Width *big.Int
+	NumMaximalTypes int
+}
+
+func (m *ShardMerge) Density() *big.Rat {
+	return new(big.Rat).SetFrac(m.Width, Factorial(m.Degree))
+}
+
+// MergeShardFiles ors the marks of the shard files, checks that their
+// slices cover the partitions exactly, and sums the width.  the
+// partitions are mapped from partitionFile if it is given, and
+// generated otherwise.
+func MergeShardFiles(paths []string, partitionFile string, numWorkers int) (*ShardMerge, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no shard files to merge")
+	}
+	var shards []*shardFile
+	for _, path := range paths {
+		sf, err := readShardFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(shards) > 0 && (sf.degree != shards[0].degree || sf.size != shards[0].size) {
+			return nil, fmt.Errorf("shard files of different degrees; %s n=%d; %s n=%d",
+				shards[0].path, shards[0].degree, sf.path, sf.degree)
+		}
+		shards = append(shards, sf)
+	}
+	sort.Slice(shards, func(a, b int) bool { return shards[a].begin < shards[b].begin })
+	degree, size := shards[0].degree, shards[0].size
+	next := 0
+	for _, sf := range shards {
+		if sf.begin > next {
+			return nil, fmt.Errorf("shards leave a gap; n=%d missing=[%d, %d) before %s", degree, next, sf.begin, sf.path)
+		}
+		if sf.begin < next {
+			return nil, fmt.Errorf("shards overlap; n=%d overlap=[%d, %d) in %s", degree, sf.begin, next, sf.path)
+		}
+		next = sf.end
+	}
+	if next != size {
+		return nil, fmt.Errorf("shards leave a gap; n=%d missing=[%d, %d) at the end", degree, next, size)
+	}
+
+	marks := newMarkTable(size)
+	for _, sf := range shards {
+		for i := range marks.bits {
+			marks.bits[i] |= binary.LittleEndian.Uint64(sf.marks[8*i:])
+		}
+	}
+
+	var partitions *PartitionStore
+	if partitionFile != "" {
+		var err error
+		if partitions, err = OpenPartitionFile(partitionFile, degree); err != nil {
+			return nil, err
+		}
+		defer partitions.Close()
+	} else {
+		var err error
+		if partitions, err = NewPartitionStoreWithWorkers(degree, numWorkers); err != nil {
+			return nil, err
+		}
+	}
+	if partitions.Len() != size {
+		return nil, fmt.Errorf("shard files do not match the partitions; n=%d shards=%d partitions=%d",
+			degree, size, partitions.Len())
+	}
+
+	log.Printf("merging shards; n=%d shards=%d", degree, len(shards))
+	slices := make([]*heightSlice, len(shards))
+	for j, sf := range shards {
+		slices[j] = &sf.heightSlice
+	}
+	width, err := sumSliceWidths(degree, slices, marks, partitions, numWorkers)
+	if err != nil {
+		return nil, err
+	}
+	return &ShardMerge{
+		Degree: degree,
+		Shards: len(shards),
+		Width: width,
+		NumMaximalTypes: marks.numUnmarked(),
+	}, nil
+}
+
+// sumSliceWidths sums the widths of the slices, numWorkers at once.
+func sumSliceWidths(degree int, slices []*heightSlice, marks markTable, partitions *PartitionStore,
+	numWorkers int) (*big.Int, error) {
+	tab := newTypeTables(degree)
+	sums := make([]*big.Int, len(slices))
+	errs := make([]error, len(slices))
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	slots := make(chan struct{}, numWorkers)
+	var wg sync.WaitGroup
+	for j, s := range slices {
+		wg.Add(1)
+		go func(j int, s *heightSlice) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			sums[j], errs[j] = s.sumWidth(degree, tab, marks, partitions)
+		}(j, s)
+	}
+	wg.Wait()
+	width := big.NewInt(0)
+	for j := range slices {
+		if errs[j] != nil {
+			return nil, errs[j]
+		}
+		width.Add(width, sums[j])
+	}
+	return width, nil
+}
+
+// sumWidth sums |class| / height over the types of the slice left
+// unmarked by the merged marks.
+func (s *heightSlice) sumWidth(degree int, tab *typeTables, marks markTable, partitions *PartitionStore) (*big.Int, error) {
+	sum := big.NewInt(0)
+	z := big.NewInt(0)
+	height := big.NewInt(0)
+	var t CycleType = make([]int, degree)
+	heights := s.heights
+	for i := s.begin; i < s.end; i++ {
+		h, k := binary.Uvarint(heights)
+		if k <= 0 || h == 0 {
+			return nil, fmt.Errorf("bad height; index=%d source=%s", i, s.source)
+		}
+		heights = heights[k:]
+		if marks.marked(i) {
+			continue
+		}
+		partitions.At(i).CycleType(t)
+		tab.centralizer(t, z)
+		z.Mul(z, height.SetUint64(h))
+		sum.Add(sum, z.Quo(tab.factorials[degree], z))
+	}
+	if len(heights) != 0 {
+		return nil, fmt.Errorf("extra heights; bytes=%d source=%s", len(heights), s.source)
+	}
+	return sum, nil
+}
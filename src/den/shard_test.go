@@ -0,0 +1,129 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseShard(t *testing.T) {
+	tcase := func(s string, i, k int, ok bool) {
+		gi, gk, err := ParseShard(s)
+		if (err == nil) != ok || (ok && (gi != i || gk != k)) {
+			t.Errorf("s=%q expected=%d/%d ok=%v got=%d/%d err=%v", s, i, k, ok, gi, gk, err)
+		}
+	}
+	tcase("0/1", 0, 1, true)
+	tcase("3/4", 3, 4, true)
+	tcase("4/4", 0, 0, false)
+	tcase("-1/4", 0, 0, false)
+	tcase("1", 0, 0, false)
+	tcase("a/b", 0, 0, false)
+}
+
+func writeShards(t *testing.T, dir string, d, k int) []string {
+	var paths []string
+	for i := 0; i < k; i++ {
+		exp, err := NewExpanderV3(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp.SetNumWorkers(2)
+		if err := exp.SetShard(i, k); err != nil {
+			t.Fatal(err)
+		}
+		path := ShardFilePath(dir, d, i, k)
+		if err := exp.WriteShardFile(path); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestMergeShardsMatchesUnbrokenRun(t *testing.T) {
+	maxDegree := 30
+	if testing.Short() {
+		maxDegree = 22
+	}
+	dir := t.TempDir()
+	for d := 1; d <= maxDegree; d += 3 {
+		exp, err := NewExpanderV3(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, k := range []int{1, 2, 5} {
+			merge, err := MergeShardFiles(writeShards(t, dir, d, k), "", 2)
+			if err != nil {
+				t.Fatalf("d=%d k=%d: %v", d, k, err)
+			}
+			if merge.Width.Cmp(exp.Width()) != 0 || merge.NumMaximalTypes != exp.NumMaximalTypes() ||
+				merge.Density().Cmp(exp.Density()) != 0 || merge.Shards != k {
+				t.Errorf("d=%d k=%d; expected width=%v maximal=%d got width=%v maximal=%d",
+					d, k, exp.Width(), exp.NumMaximalTypes(), merge.Width, merge.NumMaximalTypes)
+			}
+		}
+	}
+}
+
+func TestMergeShardsChecksCoverage(t *testing.T) {
+	d := 14
+	dir := t.TempDir()
+	paths := writeShards(t, dir, d, 3)
+	other := writeShards(t, dir, d+1, 3)
+	corrupt := ShardFilePath(dir, d, 9, 9)
+	b, err := os.ReadFile(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[len(b)-1] ^= 0x40
+	if err := os.WriteFile(corrupt, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	type tcase struct {
+		name string
+		paths []string
+		expected string
+	}
+	tcases := []tcase{
+		tcase{"complete", paths, ""},
+		tcase{"reordered", []string{paths[2], paths[0], paths[1]}, ""},
+		tcase{"gap", []string{paths[0], paths[2]}, "gap"},
+		tcase{"end", paths[:2], "at the end"},
+		tcase{"start", paths[1:], "gap"},
+		tcase{"overlap", []string{paths[0], paths[1], paths[1], paths[2]}, "overlap"},
+		tcase{"degrees", []string{paths[0], other[1], other[2]}, "different degrees"},
+		tcase{"corrupt", []string{paths[0], corrupt, paths[2]}, "checksum"},
+		tcase{"none", nil, "no shard files"},
+	}
+	for _, c := range tcases {
+		_, err := MergeShardFiles(c.paths, "", 1)
+		if c.expected == "" {
+			if err != nil {
+				t.Errorf("%s; unexpected error %v", c.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("%s; expected error containing %q got=%v", c.name, c.expected, err)
+		}
+	}
+}
+
+func TestShardedExpanderHasNoWidth(t *testing.T) {
+	exp, err := NewExpanderV3(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exp.SetShard(2, 2); err == nil {
+		t.Errorf("expected an error for shard 2/2")
+	}
+	if err := exp.SetShard(0, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exp.WidthContext(context.Background()); !errors.Is(err, ErrSharded) {
+		t.Errorf("expected err=%v got=%v", ErrSharded, err)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"fmt"
+)
+
+// Type is a cycle type in canonical form: its degree, and its cycle
+// lengths in ascending order, one byte each, held in a string.  a Type
+// is immutable and comparable, so it serves directly as a map key, and
+// unlike the CycleType slice it does not depend on how far the slice
+// was padded.  the zero Type is the empty type of degree 0.
+type Type struct {
+	degree int
+	parts string
+}
+
+const MaxTypeDegree = 255
+
+func newType(degree int, parts []byte) Type {
+	if degree > MaxTypeDegree {
+		panic(fmt.Sprintf("degree out of range for type; degree=%d max=%d", degree, MaxTypeDegree))
+	}
+	return Type{degree, string(parts)}
+}
+
+// Type returns the canonical form of the partition, which must be
+// ascending, as the partitions of this package are.
+func (p Partition) Type() Type {
+	parts := make([]byte, len(p))
+	degree := 0
+	for i, x := range p {
+		if x < 1 || x > MaxTypeDegree || (i > 0 && x < p[i-1]) {
+			panic(fmt.Sprintf("not an ascending partition; p=%v", p))
+		}
+		parts[i] = byte(x)
+		degree += x
+	}
+	return newType(degree, parts)
+}
+
+func (p PackedPartition) Type() Type {
+	return Type{p.Sum(), string(p)}
+}
+
+// Type returns the canonical form of the cycle type; trailing zeros
+// do not matter, so the degree is DegreeOld, not Degree.
+func (ct *CycleType) Type() Type {
+	var parts []byte
+	degree := 0
+	for i, m := range *ct {
+		for j := 0; j < m; j++ {
+			parts = append(parts, byte(i+1))
+		}
+		degree += (i+1) * m
+	}
+	return newType(degree, parts)
+}
+
+func (t Type) Degree() int {
+	return t.degree
+}
+
+// NumCycles counts the cycles, fixed points included.
+func (t Type) NumCycles() int {
+	return len(t.parts)
+}
+
+func (t Type) Partition() Partition {
+	p := make(Partition, len(t.parts))
+	for i := 0; i < len(t.parts); i++ {
+		p[i] = int(t.parts[i])
+	}
+	return p
+}
+
+// CycleType returns the sagan form, padded to the degree.
+func (t Type) CycleType() CycleType {
+	ct := make(CycleType, t.degree)
+	for i := 0; i < len(t.parts); i++ {
+		ct[t.parts[i]-1]++
+	}
+	return ct
+}
+
+// Less is Partition.Less: types of one degree are ordered as ruleAsc
+// generates their partitions.
+func (t Type) Less(u Type) bool {
+	return t.parts < u.parts
+}
+
+func (t Type) String() string {
+	if t.degree == 0 {
+		return "()"
+	}
+	ct := t.CycleType()
+	return ct.String()
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"math/big"
+)
+
+// typeTables holds the factorials, centralizer factors and prime power
+// totients needed for the class size and height of every type of one
+// degree, so that summing the width over millions of types does not
+// rebuild them per type.  the tables are read only once built and may
+// be shared by any number of workers.
+type typeTables struct {
+	degree int
+	factorials []*big.Int // factorials[m] = m!
+	primes []int
+	// centralizerFactor[l][m] = l^m * m!, the contribution of m
+	// cycles of length l to the order of the centralizer.
+	centralizerFactor [][]*big.Int
+	// primePowerTotient[p][e] = phi(p^e), for p^e <= degree.
+	primePowerTotient [][]*big.Int
+}
+
+func newTypeTables(degree int) *typeTables {
+	tab := &typeTables{
+		degree: degree,
+		factorials: make([]*big.Int, degree+1),
+		primes: Primes(degree),
+		centralizerFactor: make([][]*big.Int, degree+1),
+		primePowerTotient: make([][]*big.Int, degree+1),
+	}
+	tab.factorials[0] = big.NewInt(1)
+	for m := 1; m <= degree; m++ {
+		tab.factorials[m] = big.NewInt(int64(m))
+		tab.factorials[m].Mul(tab.factorials[m], tab.factorials[m-1])
+	}
+	for l := 1; l <= degree; l++ {
+		row := make([]*big.Int, degree/l+1)
+		row[0] = big.NewInt(1)
+		for m := 1; m < len(row); m++ {
+			row[m] = big.NewInt(int64(l * m))
+			row[m].Mul(row[m], row[m-1])
+		}
+		tab.centralizerFactor[l] = row
+	}
+	for _, p := range tab.primes {
+		row := []*big.Int{big.NewInt(1), big.NewInt(int64(p - 1))}
+		for q := p * p; q <= degree; q *= p {
+			z := big.NewInt(int64(p))
+			row = append(row, z.Mul(z, row[len(row)-1]))
+		}
+		tab.primePowerTotient[p] = row
+	}
+	return tab
+}
+
+// typeScratch is the per worker state for typeTables.
+type typeScratch struct {
+	orderExponent []int
+	z, height *big.Int
+}
+
+func (tab *typeTables) newScratch() *typeScratch {
+	return &typeScratch{
+		orderExponent: make([]int, tab.degree+1),
+		z: big.NewInt(0),
+		height: big.NewInt(0),
+	}
+}
+
+// centralizer sets result to the order of the centralizer of t.
+func (tab *typeTables) centralizer(t CycleType, result *big.Int) {
+	result.SetInt64(1)
+	for i, m := range t {
+		if m > 0 {
+			result.Mul(result, tab.centralizerFactor[i+1][m])
+		}
+	}
+}
+
+// height sets result to phi(order of t), assembling the order from the
+// cycle lengths present.
+func (tab *typeTables) height(t CycleType, s *typeScratch, result *big.Int) {
+	for i := 1; i < len(t); i++ {
+		if t[i] == 0 {
+			continue
+		}
+		for _, x := range Factor(i + 1) {
+			if x.Exponent > s.orderExponent[x.Prime] {
+				s.orderExponent[x.Prime] = x.Exponent
+			}
+		}
+	}
+	tab.totientOfOrder(s, result)
+}
+
+// totientOfOrder sets result to the totient of prod p^e over the
+// exponents in s, and clears them.
+func (tab *typeTables) totientOfOrder(s *typeScratch, result *big.Int) {
+	result.SetInt64(1)
+	for _, p := range tab.primes {
+		if e := s.orderExponent[p]; e > 0 {
+			result.Mul(result, tab.primePowerTotient[p][e])
+			s.orderExponent[p] = 0
+		}
+	}
+}
+
+// typeWidth sets result to |class of t| / phi(order of t), which is
+// n! / (|centralizer of t| * phi(order of t)).
+func (tab *typeTables) typeWidth(t CycleType, s *typeScratch, result *big.Int) {
+	tab.height(t, s, s.height)
+	tab.centralizer(t, s.z)
+	s.z.Mul(s.z, s.height)
+	result.Quo(tab.factorials[tab.degree], s.z)
+}
@@ -0,0 +1,38 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestTypeTablesAgreeWithCycleType(t *testing.T) {
+	maxDegree := 16
+	if testing.Short() {
+		maxDegree = 12
+	}
+	for n := 1; n <= maxDegree; n++ {
+		tab := newTypeTables(n)
+		scratch := tab.newScratch()
+		z := big.NewInt(0)
+		ct := make(CycleType, n)
+		ForEachPartition(n, func(p Partition) {
+			p.CycleType(ct)
+			tab.centralizer(ct, z)
+			if expected := ct.CardinalityOfCentralizer(); z.Cmp(expected) != 0 {
+				t.Errorf("centralizer; t=%v expected=%v got=%v", &ct, expected, z)
+			}
+			tab.height(ct, scratch, z)
+			if expected := ct.OrderFactorization().Totient(); z.Cmp(expected) != 0 {
+				t.Errorf("height; t=%v expected=%v got=%v", &ct, expected, z)
+			}
+			tab.typeWidth(ct, scratch, z)
+			expected := ct.CardinalityOfConjugacyClass()
+			expected.Quo(expected, ct.OrderFactorization().Totient())
+			if z.Cmp(expected) != 0 {
+				t.Errorf("width; t=%v expected=%v got=%v", &ct, expected, z)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestTypeRoundTrip(t *testing.T) {
+	for n := 1; n <= 12; n++ {
+		ForEachPartition(n, func(p Partition) {
+			x := p.Type()
+			if x.Degree() != n {
+				t.Errorf("degree; p=%v expected=%d got=%d", p, n, x.Degree())
+			}
+			if !x.Partition().Equal(p) {
+				t.Errorf("partition; p=%v got=%v", p, x.Partition())
+			}
+			ct := x.CycleType()
+			if ct.Degree() != n || ct.Type() != x {
+				t.Errorf("cycle type; p=%v ct=%v", p, &ct)
+			}
+			packed := make(PackedPartition, len(p))
+			for i, y := range p {
+				packed[i] = PartitionInt(y)
+			}
+			if packed.Type() != x {
+				t.Errorf("packed; p=%v", p)
+			}
+		})
+	}
+}
+
+func TestTypeIgnoresPadding(t *testing.T) {
+	tcase := func(a, b CycleType, expected bool) {
+		if got := a.Type() == b.Type(); got != expected {
+			t.Errorf("a=%v b=%v expected=%v got=%v", a, b, expected, got)
+		}
+	}
+	tcase(CycleType{1, 1}, CycleType{1, 1, 0, 0}, true)
+	tcase(CycleType{0, 0, 1}, CycleType{0, 0, 1, 0, 0}, true)
+	tcase(CycleType{1, 1}, CycleType{3}, false)
+	tcase(CycleType{}, CycleType{0}, true)
+}
+
+func TestTypeOrderIsRuleAsc(t *testing.T) {
+	n := 18
+	if testing.Short() {
+		n = 12
+	}
+	var prev Type
+	i := 0
+	ForEachPartition(n, func(p Partition) {
+		x := p.Type()
+		if i > 0 && !prev.Less(x) {
+			t.Errorf("order; i=%d prev=%v x=%v", i, prev, x)
+		}
+		prev = x
+		i++
+	})
+	// and across degrees, as Partition.Less
+	for i := 0; i < 1000; i++ {
+		a := RandomCycleType(1 + rand.Intn(20))
+		b := RandomCycleType(1 + rand.Intn(20))
+		pa, pb := a.Type().Partition(), b.Type().Partition()
+		if a.Type().Less(b.Type()) != pa.Less(pb) {
+			t.Errorf("less; a=%v b=%v", pa, pb)
+		}
+	}
+}
+
+func TestTypeAsMapKey(t *testing.T) {
+	m := make(map[Type]int)
+	i := 0
+	ForEachPartition(10, func(p Partition) {
+		m[p.Type()] = i
+		i++
+	})
+	if len(m) != 42 {
+		t.Errorf("expected 42 distinct types; got=%d", len(m))
+	}
+	identity := CycleType{10}
+	if m[identity.Type()] != 0 {
+		t.Errorf("expected identity first; got=%d", m[identity.Type()])
+	}
+	if (Type{}).Degree() != 0 || (Type{}).String() != "()" {
+		t.Errorf("zero type; got=%v", Type{})
+	}
+}
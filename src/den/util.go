@@ -3,9 +3,13 @@
 package den
 
 import (
+	"fmt"
 	"math"
 	"math/big"
 	"math/rand"
+	"runtime"
+	"strconv"
+	"strings"
 )
 
 func ShuffleArray(v []int) []int {
@@ -31,72 +35,40 @@ func GCD(a, b int) int {
 }
 
 func LCM(v []int) int {
-	if len(v) == 0 {
+	f, ok := lcmFactorization(v)
+	if !ok {
 		return 0
 	}
-	z := make([]int, len(v))
-	copy(z, v)
-	for true {
-		// determine if uniform and find min
-		var min int = math.MaxInt32
-		var minCol int
-		var prev int
-		var uniform bool = true
-
-		for i, x := range z {
-			if i > 0 && x != prev {
-				uniform = false
-			}
-			if x < min {
-				min = x
-				minCol = i
-			}
-			prev = x
-		}
-		if uniform {
-			break
-		}
-		// grow min col
-		z[minCol] += v[minCol]
+	z, fits := f.Int64()
+	if !fits || int64(int(z)) != z {
+		panic(fmt.Sprintf("LCM overflows int; v=%v lcm=%v", v, f))
 	}
-	return z[0]
+	return int(z)
 }
 
 func LCMb(v []int, result *big.Int) {
-	// future: optmize mem
-	result.SetInt64(0)
-	if len(v) == 0 {
+	f, ok := lcmFactorization(v)
+	if !ok {
+		result.SetInt64(0)
 		return
 	}
-	z := make([]*big.Int, len(v))
-	for i := range v {
-		z[i] = big.NewInt(int64(v[i]))
-	}
-	bigNegativeOne := big.NewInt(-1)
-	for true {
-		// determine if uniform and find min
-		var min *big.Int = big.NewInt(-1)
-		var minCol int
-		var prev *big.Int = big.NewInt(0)
-		var uniform bool = true
+	result.Set(f.Int())
+}
 
-		for i, x := range z {
-			if i > 0 && x.Cmp(prev) != 0 {
-				uniform = false
-			}
-			if x.Cmp(min) < 0 || min.Cmp(bigNegativeOne) == 0 {
-				min.Set(x)
-				minCol = i
-			}
-			prev.Set(x)
-		}
-		if uniform {
-			break
+// lcmFactorization returns false if v is empty or contains a zero, in
+// which case the lcm is taken to be zero.
+func lcmFactorization(v []int) (Factorization, bool) {
+	if len(v) == 0 {
+		return nil, false
+	}
+	f := Factorization{}
+	for _, x := range v {
+		if x == 0 {
+			return nil, false
 		}
-		// grow min col
-		z[minCol].Add(z[minCol], big.NewInt(int64(v[minCol])))
+		f = f.LCM(Factor(x))
 	}
-	result.Set(z[0])
+	return f, true
 }
 
 func Factorial(n int) *big.Int {
@@ -119,15 +91,52 @@ func Exp(a, b int) *big.Int {
 	return x.Exp(big.NewInt(int64(a)), big.NewInt(int64(b)), nil)
 }
 
-func Totient(a, result *big.Int) {
-	result.SetInt64(1)
-	bigOne := big.NewInt(1)
-	g := big.NewInt(0)
-	for i := big.NewInt(2); i.Cmp(a) == -1; i.Add(i, bigOne) {
-		g.GCD(nil, nil, a, i)
-		//log.Printf("a=%v i=%v gcd=%v", a, i, g)
-		if g.Cmp(bigOne) == 0 {
-			result.Add(result, bigOne)
+// Totient sets result to the euler totient of a, taken to be 1 for
+// a < 1.  a prime factor beyond the reach of FactorBig is taken as
+// it is: phi(f * q) = phi(f) * (q - 1) for q prime and coprime to f.
+// it fails only if trialFactorBig cannot factor a.
+func Totient(a, result *big.Int) error {
+	if a.Sign() < 1 {
+		result.SetInt64(1)
+		return nil
+	}
+	f, rest, err := trialFactorBig(a)
+	if err != nil {
+		return err
+	}
+	result.Set(f.Totient())
+	if rest.Cmp(bigOne) > 0 {
+		result.Mul(result, rest.Sub(rest, bigOne))
+	}
+	return nil
+}
+
+// ParseByteSize parses a byte count with an optional binary unit
+// suffix, e.g. "512", "1.5G" or "64g".
+func ParseByteSize(s string) (int64, error) {
+	units := "KMGTPE"
+	shift := uint(0)
+	if len(s) > 0 {
+		if i := strings.IndexByte(units, strings.ToUpper(s[len(s)-1:])[0]); i >= 0 {
+			shift = uint(10 * (i + 1))
+			s = s[:len(s)-1]
 		}
 	}
+	x, err := strconv.ParseFloat(s, 64)
+	if err != nil || x < 0 {
+		return 0, fmt.Errorf("bad byte size: %q", s)
+	}
+	x *= float64(uint64(1) << shift)
+	if x >= math.MaxInt64 {
+		return 0, fmt.Errorf("byte size out of range: %q", s)
+	}
+	return int64(x), nil
+}
+
+// HeapSize is the bytes of allocated heap objects, as the sequences of
+// store sizes measure them.
+func HeapSize() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
 }
@@ -72,3 +72,30 @@ func TestExp(t *testing.T) {
 	tcase(3, 3, big.NewInt(27))
 	// xxx add big case
 }
+
+func TestParseByteSize(t *testing.T) {
+	type tcase struct {
+		s string
+		expected int64
+		ok bool
+	}
+	tcases := []tcase{
+		tcase{"0", 0, true},
+		tcase{"512", 512, true},
+		tcase{"2K", 2048, true},
+		tcase{"1.5G", 3 << 29, true},
+		tcase{"64g", 64 << 30, true},
+		tcase{"1T", 1 << 40, true},
+		tcase{"", 0, false},
+		tcase{"G", 0, false},
+		tcase{"-1", 0, false},
+		tcase{"12X", 0, false},
+		tcase{"9E", 0, false},
+	}
+	for _, c := range tcases {
+		got, err := ParseByteSize(c.s)
+		if (err == nil) != c.ok || got != c.expected {
+			t.Errorf("s=%q expected=%d ok=%v got=%d err=%v", c.s, c.expected, c.ok, got, err)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// BruteForce counts the maximal cyclic subgroups of S_n element by
+// element, as a check on the type-level engines: it knows nothing of
+// types but to tally its results by them.
+//
+// the n! permutations are indexed in lexicographic order, which is the
+// order of their Lehmer ranks.  each cyclic subgroup is walked once,
+// from the first of its generators met: its elements h^k are the
+// generators for gcd(k, m) = 1, m the order of h, and for gcd(k, m) > 1
+// generate proper subgroups of it, so are not maximal.  an element is
+// maximal if nothing marks it so; the width is the number of cyclic
+// subgroups with a maximal generator.
+type BruteForce struct {
+	degree int
+	types map[Type]*bruteForceType
+	width *big.Int
+	numMaximalTypes int
+
+	TimeToEnumerate time.Duration
+}
+
+// bruteForceType is the tally of the elements of one type.
+type bruteForceType struct {
+	cycleType CycleType
+	elements int
+	maximal int // elements generating a maximal cyclic subgroup
+	subgroups int // maximal cyclic subgroups generated by the type
+}
+
+// MaxBruteForceDegree bounds BruteForce; 10! elements take a few
+// seconds and some 50M of memory, and 11! would take eleven times that.
+const MaxBruteForceDegree = 10
+
+func NewBruteForce(degree int) (*BruteForce, error) {
+	if err := checkDegree("brute force", degree, MaxBruteForceDegree); err != nil {
+		return nil, err
+	}
+	return &BruteForce{degree: degree}, nil
+}
+
+func (bf *BruteForce) Degree() int {
+	return bf.degree
+}
+
+func (bf *BruteForce) Width() *big.Int {
+	bf.enumerate()
+	return bf.width
+}
+
+func (bf *BruteForce) NumMaximalTypes() int {
+	bf.enumerate()
+	return bf.numMaximalTypes
+}
+
+func (bf *BruteForce) Density() *big.Rat {
+	d := big.NewRat(1, 1)
+	d.SetFrac(bf.Width(), Factorial(bf.degree))
+	return d
+}
+
+func (bf *BruteForce) enumerate() {
+	if bf.types != nil {
+		return
+	}
+	t0 := time.Now()
+	n := bf.degree
+	size := int(Factorial(n).Int64())
+	elems := make([]byte, 0, size*n)
+	p := make([]byte, n)
+	for i := range p {
+		p[i] = byte(i)
+	}
+	for {
+		elems = append(elems, p...)
+		if !nextPermutation(p) {
+			break
+		}
+	}
+	at := func(i int) []byte { return elems[i*n : (i+1)*n] }
+
+	walked := make([]bool, size) // generator of a walked subgroup
+	first := make([]bool, size) // the generator it was walked from
+	nonMaximal := make([]bool, size)
+	power := make([]byte, n)
+	next := make([]byte, n)
+	var powers []int // ranks of h^1, ..., h^m
+	for h := 0; h < size; h++ {
+		if walked[h] {
+			continue
+		}
+		first[h] = true
+		g := at(h)
+		copy(power, g)
+		powers = powers[:0]
+		for {
+			r := lehmerRank(power)
+			powers = append(powers, r)
+			if r == 0 { // the identity
+				break
+			}
+			for i, x := range power {
+				next[i] = g[x]
+			}
+			power, next = next, power
+		}
+		m := len(powers)
+		for k := 1; k <= m; k++ {
+			if GCD(k, m) == 1 {
+				walked[powers[k-1]] = true
+			} else {
+				nonMaximal[powers[k-1]] = true
+			}
+		}
+	}
+
+	bf.types = make(map[Type]*bruteForceType)
+	bf.width = big.NewInt(0)
+	subgroups := 0
+	for x := 0; x < size; x++ {
+		t := permutationCycleType(at(x))
+		key := t.Type()
+		tally, found := bf.types[key]
+		if !found {
+			tally = &bruteForceType{cycleType: t}
+			bf.types[key] = tally
+		}
+		tally.elements++
+		if !nonMaximal[x] {
+			tally.maximal++
+			if first[x] {
+				tally.subgroups++
+				subgroups++
+			}
+		}
+	}
+	bf.width.SetInt64(int64(subgroups))
+	for _, tally := range bf.types {
+		if tally.maximal > 0 {
+			bf.numMaximalTypes++
+		}
+	}
+	bf.TimeToEnumerate = time.Since(t0)
+}
+
+// nextPermutation steps p to the next permutation in lexicographic
+// order, and reports false after the last.
+func nextPermutation(p []byte) bool {
+	i := len(p) - 2
+	for i >= 0 && p[i] >= p[i+1] {
+		i--
+	}
+	if i < 0 {
+		return false
+	}
+	j := len(p) - 1
+	for p[j] <= p[i] {
+		j--
+	}
+	p[i], p[j] = p[j], p[i]
+	for a, b := i+1, len(p)-1; a < b; a, b = a+1, b-1 {
+		p[a], p[b] = p[b], p[a]
+	}
+	return true
+}
+
+// lehmerRank returns the index of p in lexicographic order.
+func lehmerRank(p []byte) int {
+	r := 0
+	for i := range p {
+		smaller := 0
+		for _, x := range p[i+1:] {
+			if x < p[i] {
+				smaller++
+			}
+		}
+		r = r*(len(p)-i) + smaller
+	}
+	return r
+}
+
+func permutationCycleType(p []byte) CycleType {
+	t := make(CycleType, len(p))
+	var seen [MaxBruteForceDegree]bool
+	for i := range p {
+		if seen[i] {
+			continue
+		}
+		length := 0
+		for j := i; !seen[j]; j = int(p[j]) {
+			seen[j] = true
+			length++
+		}
+		t[length-1]++
+	}
+	return t
+}
+
+// Verification is the comparison of a BruteForce with an ExpanderV3 of
+// the same degree.
+type Verification struct {
+	Degree int
+	Width, ExpanderWidth *big.Int
+	NumMaximalTypes, ExpanderNumMaximalTypes int
+	Density, ExpanderDensity *big.Rat
+	Types []TypeDisagreement // in the order of the expander's partitions
+}
+
+// TypeDisagreement is a type on which the brute force and the
+// expander differ, or whose elements are not all alike.
+type TypeDisagreement struct {
+	Type CycleType
+	Elements int
+	MaximalElements int
+	Subgroups int // maximal cyclic subgroups of the brute force
+	ExpanderMaximal bool
+	ExpanderWidth *big.Int
+}
+
+func (d TypeDisagreement) String() string {
+	return fmt.Sprintf("type=%v elements=%d maximal=%d subgroups=%d expander: maximal=%v width=%v",
+		&d.Type, d.Elements, d.MaximalElements, d.Subgroups, d.ExpanderMaximal, d.ExpanderWidth)
+}
+
+// OK reports whether the brute force and the expander agree
+// throughout.
+func (v *Verification) OK() bool {
+	return len(v.Types) == 0 && v.Width.Cmp(v.ExpanderWidth) == 0 &&
+		v.NumMaximalTypes == v.ExpanderNumMaximalTypes && v.Density.Cmp(v.ExpanderDensity) == 0
+}
+
+// Verify compares the brute force with exp, type by type, expanding
+// exp if need be, and returns the errors of its expansion.
+func (bf *BruteForce) Verify(exp *ExpanderV3) (*Verification, error) {
+	if exp.Degree() != bf.degree {
+		return nil, fmt.Errorf("verifying an expander of another degree; n=%d expander=%d", bf.degree, exp.Degree())
+	}
+	if err := exp.checkUnsharded(); err != nil {
+		return nil, err
+	}
+	width, err := exp.WidthContext(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	v := &Verification{
+		Degree: bf.degree,
+		Width: bf.Width(),
+		ExpanderWidth: width,
+		NumMaximalTypes: bf.NumMaximalTypes(),
+		ExpanderNumMaximalTypes: exp.NumMaximalTypes(),
+		Density: bf.Density(),
+		ExpanderDensity: exp.Density(),
+	}
+	seen := make(map[Type]bool)
+	partitions := exp.Partitions()
+	buf := make([]int, bf.degree)
+	for i := 0; i < partitions.Len(); i++ {
+		p := partitions.PartitionAt(i, buf)
+		var t CycleType = make([]int, bf.degree)
+		p.CycleType(t)
+		key := t.Type()
+		seen[key] = true
+		d := TypeDisagreement{
+			Type: t,
+			ExpanderMaximal: !exp.marked(i),
+			ExpanderWidth: exp.TypeWidth(i, p, t),
+		}
+		if tally, found := bf.types[key]; found {
+			d.Elements, d.MaximalElements, d.Subgroups = tally.elements, tally.maximal, tally.subgroups
+		}
+		alike := d.MaximalElements == 0 || d.MaximalElements == d.Elements
+		if !alike || d.Elements == 0 || (d.MaximalElements > 0) != d.ExpanderMaximal ||
+			d.ExpanderWidth.Cmp(big.NewInt(int64(d.Subgroups))) != 0 {
+			v.Types = append(v.Types, d)
+		}
+	}
+	var missing []TypeDisagreement
+	for key, tally := range bf.types {
+		if !seen[key] {
+			missing = append(missing, TypeDisagreement{
+				Type: tally.cycleType,
+				Elements: tally.elements,
+				MaximalElements: tally.maximal,
+				Subgroups: tally.subgroups,
+				ExpanderWidth: big.NewInt(0),
+			})
+		}
+	}
+	sort.Slice(missing, func(a, b int) bool {
+		return missing[a].Type.Type().Less(missing[b].Type.Type())
+	})
+	v.Types = append(v.Types, missing...)
+	return v, nil
+}
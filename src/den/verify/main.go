@@ -0,0 +1,55 @@
+// Copyright 2018 Adam Marks
+
+package main
+
+import (
+	"den"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+// verify checks ExpanderV3 against a brute force count over all n!
+// elements, degree by degree, printing the types on which they
+// disagree.  it exits 1 on any disagreement.
+func main() {
+	begin := 1
+	end := 8
+
+	flag.IntVar(&begin, "b", begin, "begin degree")
+	flag.IntVar(&end, "e", end, fmt.Sprintf("end degree (at most %d)", den.MaxBruteForceDegree))
+	flag.Parse()
+
+	ok := true
+	fmt.Printf("#n WidthV3 NumMaximalTypesV3 DensityV3 agree\n")
+	for n := begin; n <= end; n++ {
+		bf, err := den.NewBruteForce(n)
+		if err != nil {
+			log.Fatal(err)
+		}
+		exp, err := den.NewExpanderV3(n)
+		if err != nil {
+			log.Fatal(err)
+		}
+		v, err := bf.Verify(exp)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("verified; n=%d agree=%v enumtime=%v", n, v.OK(), bf.TimeToEnumerate)
+		density, _ := v.Density.Float64()
+		fmt.Printf("%d %v %d %v %v\n", n, v.Width, v.NumMaximalTypes, density, v.OK())
+		if v.OK() {
+			continue
+		}
+		ok = false
+		fmt.Printf("# n=%d brute force: width=%v types=%d density=%v\n", n, v.Width, v.NumMaximalTypes, v.Density)
+		fmt.Printf("# n=%d expander: width=%v types=%d density=%v\n", n, v.ExpanderWidth, v.ExpanderNumMaximalTypes, v.ExpanderDensity)
+		for _, d := range v.Types {
+			fmt.Printf("# n=%d %v\n", n, d)
+		}
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestBruteForceKnownValues(t *testing.T) {
+	type tcase struct {
+		degree int
+		width int64
+		numMaximalTypes int
+	}
+	tcases := []tcase{
+		tcase{1, 1, 1},
+		tcase{2, 1, 1},
+		tcase{3, 4, 2},
+		tcase{4, 13, 3},
+		tcase{5, 31, 3},
+		tcase{6, 246, 5},
+		tcase{7, 1296, 6},
+		tcase{8, 10774, 11},
+	}
+	for _, c := range tcases {
+		if testing.Short() && c.degree > 7 {
+			break
+		}
+		bf, err := NewBruteForce(c.degree)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w := bf.Width(); w.Cmp(big.NewInt(c.width)) != 0 {
+			t.Errorf("width; d=%d expected %d got %v", c.degree, c.width, w)
+		}
+		if m := bf.NumMaximalTypes(); m != c.numMaximalTypes {
+			t.Errorf("maximal types; d=%d expected %d got %d", c.degree, c.numMaximalTypes, m)
+		}
+	}
+}
+
+func TestBruteForceVerifiesExpanderV3(t *testing.T) {
+	maxDegree := 8
+	if testing.Short() {
+		maxDegree = 7
+	}
+	for d := 1; d <= maxDegree; d++ {
+		bf, err := NewBruteForce(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp, err := NewExpanderV3(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := bf.Verify(exp)
+		if err != nil {
+			t.Fatalf("d=%d %v", d, err)
+		}
+		if !v.OK() {
+			t.Errorf("d=%d width=%v/%v maximal types=%d/%d types=%v", d, v.Width, v.ExpanderWidth,
+				v.NumMaximalTypes, v.ExpanderNumMaximalTypes, v.Types)
+		}
+	}
+}
+
+func TestBruteForceReportsType(t *testing.T) {
+	d := 6
+	exp, err := NewExpanderV3(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exp.Expand(); err != nil {
+		t.Fatal(err)
+	}
+	// strike out the first maximal type, as a faulty expansion would
+	partitions := exp.Partitions()
+	buf := make([]int, d)
+	i := 0
+	for exp.marked(i) {
+		i++
+	}
+	var want CycleType = make([]int, d)
+	partitions.PartitionAt(i, buf).CycleType(want)
+	exp.markTable.mark(i)
+
+	bf, err := NewBruteForce(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := bf.Verify(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.OK() {
+		t.Fatalf("expected a disagreement")
+	}
+	if len(v.Types) != 1 || v.Types[0].Type.Type() != want.Type() {
+		t.Fatalf("expected a disagreement on %v got %v", &want, v.Types)
+	}
+	if got := v.Types[0]; !(got.MaximalElements == got.Elements && got.Subgroups > 0 && !got.ExpanderMaximal) {
+		t.Errorf("unexpected disagreement %v", got)
+	}
+	if v.NumMaximalTypes != v.ExpanderNumMaximalTypes+1 {
+		t.Errorf("maximal types; expected %d got %d", v.ExpanderNumMaximalTypes+1, v.NumMaximalTypes)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"math/big"
+	"sync"
+)
+
+// workChunk is the half open range [begin, end) of partition indices.
+type workChunk struct {
+	begin, end int
+}
+
+func (c workChunk) len() int {
+	return c.end - c.begin
+}
+
+// workQueue is a deque of chunks owned by one worker.  the owner pops
+// from the front and idle workers steal from the back, so that owner
+// and thief only meet when the queue is nearly drained.  no work is
+// added once the workers are started, so a worker that finds every
+// queue empty can stop.
+type workQueue struct {
+	sync.Mutex
+	chunks []workChunk
+	head int
+}
+
+func (q *workQueue) push(c workChunk) {
+	q.Lock()
+	q.chunks = append(q.chunks, c)
+	q.Unlock()
+}
+
+func (q *workQueue) pop() (c workChunk, ok bool) {
+	q.Lock()
+	if q.head < len(q.chunks) {
+		c, ok = q.chunks[q.head], true
+		q.head++
+	}
+	q.Unlock()
+	return c, ok
+}
+
+func (q *workQueue) steal() (c workChunk, ok bool) {
+	q.Lock()
+	if q.head < len(q.chunks) {
+		c, ok = q.chunks[len(q.chunks)-1], true
+		q.chunks = q.chunks[:len(q.chunks)-1]
+	}
+	q.Unlock()
+	return c, ok
+}
+
+func (q *workQueue) len() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.chunks) - q.head
+}
+
+// newWorkQueues splits [begin, end) into chunks of at most chunkSize
+// indices and deals contiguous runs of chunks to k queues.  neighbouring
+// partitions share words of the mark table and bytes of the arena, so
+// contiguous runs keep each worker on its own stretch until it has to
+// steal.
+func newWorkQueues(begin, end, chunkSize, k int) []*workQueue {
+	queues := make([]*workQueue, k)
+	for i := range queues {
+		queues[i] = &workQueue{}
+	}
+	numChunks := (end - begin + chunkSize - 1) / chunkSize
+	for j := 0; j < numChunks; j++ {
+		c := workChunk{begin + j*chunkSize, begin + (j+1)*chunkSize}
+		if c.end > end {
+			c.end = end
+		}
+		queues[j*k/numChunks].push(c)
+	}
+	return queues
+}
+
+// stealWork takes a chunk from the back of another queue, trying the
+// queues after self in turn.
+func stealWork(queues []*workQueue, self int) (c workChunk, ok bool) {
+	for i := 1; i < len(queues); i++ {
+		if c, ok = queues[(self+i)%len(queues)].steal(); ok {
+			return c, ok
+		}
+	}
+	return c, false
+}
+
+// drainWorkQueues runs f on the chunks of queues[self] and then on
+// chunks stolen from the others, until every queue is empty.  it
+// returns the number of chunks stolen.
+func drainWorkQueues(queues []*workQueue, self int, f func(workChunk)) (steals int) {
+	for {
+		c, ok := queues[self].pop()
+		if !ok {
+			if c, ok = stealWork(queues, self); !ok {
+				return steals
+			}
+			steals++
+		}
+		f(c)
+	}
+}
+
+// chunks are small enough that each worker starts with a few dozen of
+// them, and large enough that the queue locks stay cold.
+const maxWorkChunkSize = 1024
+const workChunksPerWorker = 32
+
+func workChunkSize(size, k int) int {
+	c := size / (k * workChunksPerWorker)
+	if c > maxWorkChunkSize {
+		c = maxWorkChunkSize
+	}
+	if c < 1 {
+		c = 1
+	}
+	return c
+}
+
+// chunkProgress follows the completion of the chunks of a phase, which
+// tile [begin, end).  chunks complete out of order, so those ahead of
+// the frontier are held until the gap below them closes; every index
+// below the frontier is complete.  a chunk may carry a partial sum,
+// which is added in as the frontier passes it.  observe, if set, is
+// given the indices complete, in or out of order, by the worker of the
+// chunk and by all, as each chunk completes.
+type chunkProgress struct {
+	sync.Mutex
+	frontier int
+	end int
+	ahead map[int]chunkResult // by begin
+	sum *big.Int
+	processed int
+	byWorker map[int]int
+	observe func(worker, workerProcessed, processed int)
+}
+
+type chunkResult struct {
+	end int
+	sum *big.Int
+}
+
+func newChunkProgress(begin, end int, sum *big.Int) *chunkProgress {
+	return &chunkProgress{
+		frontier: begin,
+		end: end,
+		ahead: make(map[int]chunkResult),
+		byWorker: make(map[int]int),
+		sum: new(big.Int).Set(sum),
+	}
+}
+
+func (p *chunkProgress) complete(worker int, c workChunk, sum *big.Int) {
+	p.Lock()
+	defer p.Unlock()
+	p.ahead[c.begin] = chunkResult{c.end, sum}
+	p.processed += c.len()
+	p.byWorker[worker] += c.len()
+	if p.observe != nil {
+		p.observe(worker, p.byWorker[worker], p.processed)
+	}
+	for {
+		r, ok := p.ahead[p.frontier]
+		if !ok {
+			return
+		}
+		delete(p.ahead, p.frontier)
+		if r.sum != nil {
+			p.sum.Add(p.sum, r.sum)
+		}
+		p.frontier = r.end
+	}
+}
+
+// state returns the frontier and a copy of the sum below it.
+func (p *chunkProgress) state() (frontier int, sum *big.Int) {
+	p.Lock()
+	defer p.Unlock()
+	return p.frontier, new(big.Int).Set(p.sum)
+}
+
+func (p *chunkProgress) done() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.frontier == p.end
+}
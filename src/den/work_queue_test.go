@@ -0,0 +1,104 @@
+// Copyright 2018 Adam Marks
+
+package den
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+)
+
+func TestWorkQueuesCoverEachIndexOnce(t *testing.T) {
+	type tcase struct {
+		size, chunkSize, k int
+	}
+	tcases := []tcase{
+		tcase{0, 1, 3},
+		tcase{1, 1, 1},
+		tcase{10, 3, 4},
+		tcase{10, 1, 16},
+		tcase{1000, 7, 3},
+		tcase{4096, 1024, 8},
+	}
+	for _, c := range tcases {
+		queues := newWorkQueues(0, c.size, c.chunkSize, c.k)
+		seen := make([]int, c.size)
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for w := range queues {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for {
+					chunk, ok := queues[w].pop()
+					if !ok {
+						// stealing from the start exercises the back
+						// of the other queues
+						if chunk, ok = stealWork(queues, w); !ok {
+							return
+						}
+					}
+					if chunk.len() < 1 || chunk.len() > c.chunkSize {
+						t.Errorf("bad chunk; case=%v chunk=%v", c, chunk)
+					}
+					mu.Lock()
+					for i := chunk.begin; i < chunk.end; i++ {
+						seen[i]++
+					}
+					mu.Unlock()
+				}
+			}(w)
+		}
+		wg.Wait()
+		for i, n := range seen {
+			if n != 1 {
+				t.Errorf("index not covered once; case=%v i=%d count=%d", c, i, n)
+			}
+		}
+		for w, q := range queues {
+			if q.len() != 0 {
+				t.Errorf("queue not drained; case=%v queue=%d len=%d", c, w, q.len())
+			}
+		}
+	}
+}
+
+func TestWorkQueueStealFromBack(t *testing.T) {
+	q := &workQueue{}
+	for i := 0; i < 3; i++ {
+		q.push(workChunk{i, i + 1})
+	}
+	if c, _ := q.steal(); c.begin != 2 {
+		t.Errorf("steal expected chunk 2 got %v", c)
+	}
+	if c, _ := q.pop(); c.begin != 0 {
+		t.Errorf("pop expected chunk 0 got %v", c)
+	}
+	if c, _ := q.steal(); c.begin != 1 {
+		t.Errorf("steal expected chunk 1 got %v", c)
+	}
+	if _, ok := q.pop(); ok {
+		t.Errorf("expected empty queue")
+	}
+	if _, ok := q.steal(); ok {
+		t.Errorf("expected nothing to steal")
+	}
+}
+
+func TestChunkProgressOutOfOrder(t *testing.T) {
+	p := newChunkProgress(10, 40, big.NewInt(5))
+	tcase := func(c workChunk, sum int64, expectedFrontier int, expectedSum int64) {
+		p.complete(0, c, big.NewInt(sum))
+		frontier, total := p.state()
+		if frontier != expectedFrontier || total.Int64() != expectedSum {
+			t.Errorf("after %v; expected frontier=%d sum=%d got frontier=%d sum=%v",
+				c, expectedFrontier, expectedSum, frontier, total)
+		}
+	}
+	tcase(workChunk{20, 30}, 100, 10, 5)
+	tcase(workChunk{30, 40}, 1000, 10, 5)
+	tcase(workChunk{10, 20}, 10, 40, 1115)
+	if !p.done() {
+		t.Errorf("expected done")
+	}
+}